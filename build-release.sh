@@ -3,15 +3,14 @@
 # exit on error
 set -e
 
-echo "running all unit tests"
-go test -v ./src/...
+echo "running all unit and end-to-end tests"
+go test -v -race ./src/...
 go test -v github.com/glxxyz/dedupe/param
 go test -v github.com/glxxyz/dedupe/repo
+go test -v github.com/glxxyz/dedupe/stats
+go test -v github.com/glxxyz/dedupe/dedupe
 
 # build on all the most common platforms
 env GOOS=darwin GOARCH=amd64 go build -v -o bin/macos-amd64/dedupe ./src/...
 env GOOS=linux GOARCH=amd64 go build -v -o bin/linux-amd64/dedupe ./src/...
 env GOOS=windows GOARCH=amd64 go build -v -o bin/windows-amd64/dedupe.exe ./src/...
-
-# run integration tests
-./bb-test-integration.sh
@@ -1,13 +1,17 @@
 module github.com/glxxyz/dedupe
 
-go 1.14
+go 1.15
 
 replace (
+    github.com/glxxyz/dedupe/dedupe v0.0.0 => ./src/dedupe
     github.com/glxxyz/dedupe/param v0.0.0 => ./src/param
     github.com/glxxyz/dedupe/repo v0.0.0 => ./src/repo
+    github.com/glxxyz/dedupe/stats v0.0.0 => ./src/stats
 )
 
 require (
+	github.com/glxxyz/dedupe/dedupe v0.0.0
 	github.com/glxxyz/dedupe/param v0.0.0
 	github.com/glxxyz/dedupe/repo v0.0.0
+	github.com/glxxyz/dedupe/stats v0.0.0
 )
@@ -0,0 +1,10 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import "errors"
+
+func setIdleIOPriority() error {
+	return errors.New("the idle I/O priority is only supported on Linux")
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/glxxyz/dedupe/dedupe"
+	"github.com/glxxyz/dedupe/repo"
+	"github.com/glxxyz/dedupe/stats"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+type CatalogOptions interface {
+	ReadOptions
+	FilterOptions
+	MinBytes() int64
+	Paths() []string
+	Output() string
+}
+
+// catalogReader reads and filters the files being catalogued the same way a scan does
+type catalogReader struct {
+	*fileReader
+	statistics *stats.Stats
+	minBytes   int64
+	filter     dedupe.WalkFilter
+	verbose    bool
+}
+
+func newCatalogReader(options CatalogOptions) *catalogReader {
+	useBackground(options.Background(), options.Verbose())
+	reader := &catalogReader{
+		fileReader: newFileReader(options),
+		statistics: stats.New(nil),
+		minBytes:   options.MinBytes(),
+		verbose:    options.Verbose(),
+	}
+	reader.filter = dedupe.BindFilters(fileFilters(options, nil), reader, reader.statistics)
+	return reader
+}
+
+// failed returns an error if any file couldn't be read, so the command fails once it's done what it can
+func (reader *catalogReader) failed() error {
+	if errors := reader.statistics.Summary().Errors; len(errors) > 0 {
+		return fmt.Errorf("failed to read some files: %v", errors)
+	}
+	return nil
+}
+
+// catalogEntry is a line of a catalog, the path is relative to the directory catalogued and uses / on every OS
+type catalogEntry struct {
+	Path     string    `json:"path"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+	Digest   string    `json:"sha256"`
+}
+
+// catalogDiff is what changed between two catalogs, each list sorted by path
+type catalogDiff struct {
+	renamed []samePair // the old path as a, the new one as b
+	changed []string
+	added   []string
+	removed []string
+}
+
+// createCatalog writes a catalog of the directory to --output or stdout
+func createCatalog(options CatalogOptions) error {
+	writer := io.Writer(os.Stdout)
+	skip := ""
+	if options.Output() != "" {
+		file, err := os.Create(options.Output())
+		if err != nil {
+			return fmt.Errorf("failed to create catalog: %w", err)
+		}
+		defer file.Close()
+		writer = file
+		// the catalog can be written inside the directory, but shouldn't be in it
+		skip, _ = filepath.Abs(options.Output())
+	}
+	reader := newCatalogReader(options)
+	entries, err := reader.build(options.Paths()[0], skip)
+	if err != nil {
+		return err
+	}
+	buffered := bufio.NewWriter(writer)
+	encoder := json.NewEncoder(buffered)
+	for _, entry := range entries {
+		if err := encoder.Encode(entry); err != nil {
+			return fmt.Errorf("failed to write catalog: %w", err)
+		}
+	}
+	if err := buffered.Flush(); err != nil {
+		return fmt.Errorf("failed to write catalog: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "catalogued %d files in %s\n", len(entries), options.Paths()[0])
+	return reader.failed()
+}
+
+// build hashes each regular file in the directory that the filters include, files that can't be read are counted as
+// errors and left out of it
+func (reader *catalogReader) build(root string, skip string) ([]catalogEntry, error) {
+	var entries []catalogEntry
+	err := filepath.Walk(root, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			errLog.Printf("error reading: %q: %v\n", filePath, err)
+			reader.statistics.Error(stats.ErrorWalk)
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		if absolute, _ := filepath.Abs(filePath); absolute == skip {
+			return nil
+		}
+		if info.Size() < reader.minBytes || !reader.filter.Include(filePath, info) {
+			if reader.verbose {
+				fmt.Printf("filtered out: %q\n", filePath)
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(root, filePath)
+		if err != nil {
+			return err
+		}
+		digest, err := repo.Digest(reader, reader.statistics, filePath)
+		if err != nil {
+			return nil
+		}
+		if reader.verbose {
+			fmt.Printf("catalog: %q %s\n", rel, digest)
+		}
+		entries = append(entries, catalogEntry{
+			Path:     filepath.ToSlash(rel),
+			Size:     info.Size(),
+			Modified: info.ModTime(),
+			Digest:   digest,
+		})
+		return nil
+	})
+	return entries, err
+}
+
+func readCatalog(catalogPath string) ([]catalogEntry, error) {
+	file, err := os.Open(catalogPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var entries []catalogEntry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var entry catalogEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("catalog %q line %d: %w", catalogPath, line, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// load reads a catalog, or catalogs a directory
+func (reader *catalogReader) load(catalogPath string) ([]catalogEntry, error) {
+	if info, err := os.Stat(catalogPath); err == nil && info.IsDir() {
+		return reader.build(catalogPath, "")
+	}
+	return readCatalog(catalogPath)
+}
+
+// diffCatalogs prints what was renamed, changed, added and removed between the old catalog and the new one
+func diffCatalogs(options CatalogOptions) error {
+	reader := newCatalogReader(options)
+	older, err := reader.load(options.Paths()[0])
+	if err != nil {
+		return fmt.Errorf("failed to read catalog: %w", err)
+	}
+	newer, err := reader.load(options.Paths()[1])
+	if err != nil {
+		return fmt.Errorf("failed to read catalog: %w", err)
+	}
+	diff := newCatalogDiff(older, newer)
+	writeCatalogDiff(os.Stdout, diff)
+	fmt.Fprintf(os.Stderr, "%d renamed, %d changed, %d added, %d removed\n",
+		len(diff.renamed), len(diff.changed), len(diff.added), len(diff.removed))
+	return reader.failed()
+}
+
+// newCatalogDiff pairs each path that's gone with a new path that has the same contents, one with the same name if
+// there is one, so a file copied as well as moved is a rename and an add
+func newCatalogDiff(older []catalogEntry, newer []catalogEntry) catalogDiff {
+	oldByPath := make(map[string]catalogEntry, len(older))
+	for _, entry := range older {
+		oldByPath[entry.Path] = entry
+	}
+	newByPath := make(map[string]catalogEntry, len(newer))
+	for _, entry := range newer {
+		newByPath[entry.Path] = entry
+	}
+	sortCatalog(older)
+	sortCatalog(newer)
+	var diff catalogDiff
+	added := make(map[string][]string) // digest -> the paths only in newer
+	for _, entry := range newer {
+		if oldEntry, found := oldByPath[entry.Path]; !found {
+			added[entry.Digest] = append(added[entry.Digest], entry.Path)
+		} else if oldEntry.Digest != entry.Digest {
+			diff.changed = append(diff.changed, entry.Path)
+		}
+	}
+	for _, entry := range older {
+		if _, found := newByPath[entry.Path]; found {
+			continue
+		}
+		candidates := added[entry.Digest]
+		if len(candidates) == 0 {
+			diff.removed = append(diff.removed, entry.Path)
+			continue
+		}
+		chosen := 0
+		for i, candidate := range candidates {
+			if path.Base(candidate) == path.Base(entry.Path) {
+				chosen = i
+				break
+			}
+		}
+		diff.renamed = append(diff.renamed, samePair{a: entry.Path, b: candidates[chosen]})
+		added[entry.Digest] = append(candidates[:chosen], candidates[chosen+1:]...)
+	}
+	for _, paths := range added {
+		diff.added = append(diff.added, paths...)
+	}
+	sort.Strings(diff.added)
+	return diff
+}
+
+func sortCatalog(entries []catalogEntry) {
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Path < entries[j].Path
+	})
+}
+
+func writeCatalogDiff(w io.Writer, diff catalogDiff) {
+	for _, pair := range diff.renamed {
+		fmt.Fprintf(w, "renamed: %s -> %s\n", pair.a, pair.b)
+	}
+	for _, rel := range diff.changed {
+		fmt.Fprintf(w, "changed: %s\n", rel)
+	}
+	for _, rel := range diff.added {
+		fmt.Fprintf(w, "added: %s\n", rel)
+	}
+	for _, rel := range diff.removed {
+		fmt.Fprintf(w, "removed: %s\n", rel)
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"fmt"
+	"github.com/glxxyz/dedupe/dedupe"
+	"github.com/glxxyz/dedupe/param"
+	"github.com/glxxyz/dedupe/stats"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// compareAction sees every file as it's walked, and every group of duplicates, to compare the two roots by contents.
+// Files are kept by their path relative to their root, and side 0 is A and side 1 is B.
+type compareAction struct {
+	roots    [2]string
+	minBytes int64
+	lock     sync.Mutex
+	files    [2]map[string]os.FileInfo
+	matched  [2]map[string]bool // files with a duplicate on the other side
+	same     []samePair
+}
+
+// samePair is a file in A with the same contents as one in B
+type samePair struct {
+	a string
+	b string
+}
+
+// comparison is the result, each list sorted by path
+type comparison struct {
+	same    []samePair
+	changed []string
+	onlyA   []string
+	onlyB   []string
+}
+
+func newCompareAction(paths []string, minBytes int64) *compareAction {
+	action := &compareAction{roots: [2]string{paths[0], paths[1]}, minBytes: minBytes}
+	for side := range action.files {
+		action.files[side] = make(map[string]os.FileInfo)
+		action.matched[side] = make(map[string]bool)
+	}
+	return action
+}
+
+// side returns which root the path is in and the path relative to it, or -1 if it's in neither
+func (action *compareAction) side(path string) (int, string) {
+	for side, root := range action.roots {
+		if rel, err := filepath.Rel(root, path); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return side, rel
+		}
+	}
+	return -1, ""
+}
+
+// Include remembers the files that are matched, it doesn't filter any out
+func (action *compareAction) Include(path string, info os.FileInfo) bool {
+	if !info.Mode().IsRegular() || info.Size() < action.minBytes {
+		return true
+	}
+	if side, rel := action.side(path); side >= 0 {
+		action.lock.Lock()
+		action.files[side][rel] = info
+		action.lock.Unlock()
+	}
+	return true
+}
+
+// Apply pairs each file in A with one in B, at the same path if there is one, then any left over in B with the first
+// in A
+func (action *compareAction) Apply(group dedupe.Group) {
+	var sides [2][]string
+	for _, file := range group.Files {
+		if side, rel := action.side(file.Path()); side >= 0 {
+			sides[side] = append(sides[side], rel)
+		}
+	}
+	if len(sides[0]) == 0 || len(sides[1]) == 0 {
+		return
+	}
+	action.lock.Lock()
+	defer action.lock.Unlock()
+	paired := make(map[string]bool)
+	for _, a := range sides[0] {
+		b := sides[1][0]
+		for _, candidate := range sides[1] {
+			if candidate == a {
+				b = candidate
+			}
+		}
+		action.same = append(action.same, samePair{a: a, b: b})
+		paired[b] = true
+		action.matched[0][a] = true
+	}
+	for _, b := range sides[1] {
+		if !paired[b] {
+			action.same = append(action.same, samePair{a: sides[0][0], b: b})
+		}
+		action.matched[1][b] = true
+	}
+}
+
+func (action *compareAction) comparison() comparison {
+	result := comparison{same: action.same}
+	samePath := make(map[string]bool)
+	for _, pair := range action.same {
+		if pair.a == pair.b {
+			samePath[pair.a] = true
+		}
+	}
+	for rel := range action.files[0] {
+		if _, inB := action.files[1][rel]; inB {
+			if !samePath[rel] {
+				result.changed = append(result.changed, rel)
+			}
+		} else if !action.matched[0][rel] {
+			result.onlyA = append(result.onlyA, rel)
+		}
+	}
+	for rel := range action.files[1] {
+		if _, inA := action.files[0][rel]; !inA && !action.matched[1][rel] {
+			result.onlyB = append(result.onlyB, rel)
+		}
+	}
+	sort.Slice(result.same, func(i, j int) bool {
+		if result.same[i].a != result.same[j].a {
+			return result.same[i].a < result.same[j].a
+		}
+		return result.same[i].b < result.same[j].b
+	})
+	sort.Strings(result.changed)
+	sort.Strings(result.onlyA)
+	sort.Strings(result.onlyB)
+	return result
+}
+
+// compareTrees compares the files in two directories by their contents, and can copy the ones only in B into A
+func compareTrees(options *param.Options) error {
+	statistics := stats.New(options.Paths())
+	action := newCompareAction(options.Paths(), options.MinBytes())
+	if err := runScan(options, scanOptions(options, statistics, action)); err != nil {
+		return err
+	}
+	result := action.comparison()
+	writeComparison(os.Stdout, result)
+	fmt.Fprintf(os.Stderr, "%d same, %d changed, %d only in A, %d only in B\n",
+		len(result.same), len(result.changed), len(result.onlyA), len(result.onlyB))
+	if !options.Merge() {
+		return nil
+	}
+	failed := 0
+	for _, rel := range result.onlyB {
+		if err := mergeFile(options, rel, action.files[1][rel]); err != nil {
+			errLog.Printf("error merging file: %q into: %q: %v\n", rel, options.Paths()[0], err)
+			failed++
+		}
+	}
+	fmt.Fprintf(os.Stderr, "merged %d files into %s\n", len(result.onlyB)-failed, options.Paths()[0])
+	if failed > 0 {
+		return fmt.Errorf("failed to merge %d files", failed)
+	}
+	return nil
+}
+
+// writeComparison prints a line for each file, with the paths relative to A and B
+func writeComparison(w io.Writer, result comparison) {
+	for _, pair := range result.same {
+		if pair.a == pair.b {
+			fmt.Fprintf(w, "Same:\t%s\n", pair.a)
+		} else {
+			fmt.Fprintf(w, "Same:\t%s\t%s\n", pair.a, pair.b)
+		}
+	}
+	for _, rel := range result.changed {
+		fmt.Fprintf(w, "Changed:\t%s\n", rel)
+	}
+	for _, rel := range result.onlyA {
+		fmt.Fprintf(w, "Only in A:\t%s\n", rel)
+	}
+	for _, rel := range result.onlyB {
+		fmt.Fprintf(w, "Only in B:\t%s\n", rel)
+	}
+}
+
+// mergeFile copies a file only in B to where --merge-layout puts it in A, numbering the name if it's taken
+func mergeFile(options *param.Options, rel string, info os.FileInfo) error {
+	a, b := options.Paths()[0], options.Paths()[1]
+	var destPath string
+	switch options.MergeLayout() {
+	case param.MergeByDate:
+		destPath = filepath.Join(a, info.ModTime().Format("2006"), info.ModTime().Format("01"), info.Name())
+	case param.MergeFlat:
+		destPath = filepath.Join(a, info.Name())
+	default:
+		destPath = filepath.Join(a, rel)
+	}
+	destPath = unusedName(destPath, func(path string) bool {
+		_, err := os.Lstat(path)
+		return err == nil
+	})
+	if err := os.MkdirAll(filepath.Dir(destPath), os.ModePerm); err != nil {
+		return err
+	}
+	if options.Verbose() {
+		fmt.Printf("merging %q to %q\n", filepath.Join(b, rel), destPath)
+	}
+	return copyFile(filepath.Join(b, rel), destPath)
+}
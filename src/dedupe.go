@@ -1,11 +1,14 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"github.com/glxxyz/dedupe/dedupe"
 	"github.com/glxxyz/dedupe/param"
-	"github.com/glxxyz/dedupe/repo"
+	"github.com/glxxyz/dedupe/stats"
 	"log"
 	"os"
+	"time"
 )
 
 var errLog = log.New(os.Stderr, "", 0)
@@ -15,10 +18,189 @@ func main() {
 		if options.Verbose() {
 			fmt.Printf("options: %+v\n", options)
 		}
-		var matchRepo repo.MatchRepository
-		scanForDuplicates(options, &matchRepo)
+		if err := run(options); err != nil {
+			errLog.Print(err)
+			os.Exit(1)
+		}
 	} else if err != nil {
 		errLog.Print(err)
 		os.Exit(1)
 	}
 }
+
+func run(options *param.Options) error {
+	switch options.Command() {
+	case param.CommandVerify:
+		return verifyReport(options)
+	case param.CommandApply:
+		return applyReport(options)
+	case param.CommandRestore:
+		return restoreTrash(options)
+	case param.CommandTrashVerify:
+		return verifyTrash(options)
+	case param.CommandPurge:
+		return purgeTrash(options)
+	case param.CommandExtract:
+		return extractTrash(options)
+	case param.CommandUniques:
+		return findUniques(options)
+	case param.CommandCompare:
+		return compareTrees(options)
+	case param.CommandCatalog:
+		return createCatalog(options)
+	case param.CommandCatalogDiff:
+		return diffCatalogs(options)
+	default:
+		return scanForDuplicates(options)
+	}
+}
+
+func scanForDuplicates(options *param.Options) error {
+	statistics := stats.New(options.Paths())
+	reader := newFileReader(options)
+	var action dedupe.Action = &moveAction{options: options, reader: reader, statistics: statistics, hooks: newHooks(options, statistics)}
+	var report *reportAction
+	var script *scriptAction
+	if options.Command() == param.CommandReport {
+		var err error
+		if report, err = newReportAction(options); err != nil {
+			return err
+		}
+		action = report
+	} else if options.EmitScript() != "" {
+		var err error
+		if script, err = newScriptAction(options, os.Stdout); err != nil {
+			return err
+		}
+		action = script
+	}
+	scan := scanOptions(options, statistics, action)
+	scan.Throttle = reader.Throttle()
+	if err := runScan(options, scan); err != nil {
+		return err
+	}
+	if report != nil {
+		return report.close()
+	} else if script != nil {
+		return script.close()
+	}
+	return nil
+}
+
+// useBackground sets the idle I/O priority for --background, it's for the whole process so it's set here rather than
+// by the dedupe package
+func useBackground(background bool, verbose bool) {
+	if !background {
+		return
+	}
+	if err := setIdleIOPriority(); err != nil {
+		errLog.Printf("failed to set the idle I/O priority: %v\n", err)
+	} else if verbose {
+		fmt.Println("using the idle I/O priority")
+	}
+}
+
+// runScan scans for duplicates, applying the action to each group
+func runScan(options *param.Options, scan dedupe.Options) error {
+	useBackground(options.Background(), options.Verbose())
+	scanner, err := dedupe.New(scan)
+	if err != nil {
+		return err
+	}
+	groups, err := scanner.Scan(context.Background(), options.Paths())
+	if err != nil {
+		return err
+	}
+	stopProgress := spawnProgress(options, scan.Stats)
+	spawnMetricsServer(options, scanner)
+	for range groups {
+	}
+	stopProgress()
+	writeSummary(options, scan.Stats)
+	return nil
+}
+
+func scanOptions(options *param.Options, statistics *stats.Stats, action dedupe.Action) dedupe.Options {
+	scan := dedupe.Options{
+		ModTime:     options.ModTime(),
+		Name:        options.Name(),
+		Size:        options.Size(),
+		Hash:        options.Hash(),
+		Contents:    options.Contents(),
+		Samples:     options.Samples(),
+		MinBytes:    options.MinBytes(),
+		SymLinks:    options.SymLinks(),
+		Scope:       options.Scope(),
+		Verbose:     options.Verbose(),
+		ScanBuffer:  options.ScanBuffer(),
+		Scanners:    options.Scanners(),
+		MatchBuffer: options.MatchBuffer(),
+		Matchers:    options.Matchers(),
+		MoveBuffer:  options.MoveBuffer(),
+		Movers:      options.Movers(),
+		DeviceReaders: dedupe.DeviceReaders{
+			Rotational:    options.HDDReaders(),
+			NonRotational: options.SSDReaders(),
+		},
+		MaxReadRate:        options.MaxReadRate(),
+		MaxIOPS:            options.MaxIOPS(),
+		Background:         options.Background(),
+		External:           options.External(),
+		SpillRecords:       options.SpillRecords(),
+		StateDir:           options.StateDir(),
+		Resume:             options.Resume(),
+		CheckpointInterval: time.Minute,
+		Action:             action,
+		Stats:              statistics,
+	}
+	if filters := fileFilters(options, action); len(filters) > 0 {
+		scan.Filter = filters
+	}
+	return scan
+}
+
+type FilterOptions interface {
+	MaxBytes() int64
+	Extensions() []string
+	ExcludeExtensions() []string
+	ModifiedAfter() time.Time
+	ModifiedBefore() time.Time
+	FileTypes() []string
+}
+
+// fileFilters chains the filters from the options, cheapest first, then the action if it needs to see each file
+func fileFilters(options FilterOptions, action dedupe.Action) dedupe.Filters {
+	var filters dedupe.Filters
+	if options.MaxBytes() > 0 {
+		filters = append(filters, dedupe.MaxSize(options.MaxBytes()))
+	}
+	if len(options.Extensions()) > 0 {
+		filters = append(filters, dedupe.Extensions(options.Extensions()))
+	}
+	if len(options.ExcludeExtensions()) > 0 {
+		filters = append(filters, dedupe.ExcludeExtensions(options.ExcludeExtensions()))
+	}
+	if !options.ModifiedAfter().IsZero() || !options.ModifiedBefore().IsZero() {
+		filters = append(filters, dedupe.Modified(options.ModifiedAfter(), options.ModifiedBefore()))
+	}
+	if len(options.FileTypes()) > 0 {
+		filters = append(filters, dedupe.FileTypes(options.FileTypes()))
+	}
+	if filter, ok := action.(dedupe.WalkFilter); ok {
+		filters = append(filters, filter)
+	}
+	return filters
+}
+
+func writeSummary(options *param.Options, statistics *stats.Stats) {
+	var err error
+	switch options.Summary() {
+	case "text":
+		err = statistics.Summary().WriteText(os.Stderr)
+	case "json":
+		err = statistics.Summary().WriteJSON(os.Stderr)
+	}
+	if err != nil {
+		errLog.Printf("error writing summary: %v\n", err)
+	}
+}
@@ -0,0 +1,139 @@
+package dedupe
+
+import (
+	"context"
+	"fmt"
+	"github.com/glxxyz/dedupe/repo"
+	"sync"
+	"sync/atomic"
+)
+
+// DeviceReaders gives each device its own queue of files to match, with its own number of readers, so a spinning disk
+// isn't thrashed by random reads while other disks sit idle. It's off while both are zero.
+type DeviceReaders struct {
+	Rotational    int // readers for each spinning disk
+	NonRotational int // readers for each SSD, or any device that can't be identified
+}
+
+func (readers DeviceReaders) enabled() bool {
+	return readers.Rotational > 0 || readers.NonRotational > 0
+}
+
+// forDevice is the number of readers for a device, and what kind of device it is
+func (readers DeviceReaders) forDevice(device uint64) (int, string) {
+	count := readers.NonRotational
+	kind := "non-rotational"
+	if isRotational, known := rotational(device); !known {
+		kind = "unknown"
+	} else if isRotational {
+		count = readers.Rotational
+		kind = "rotational"
+	}
+	if count < 1 {
+		count = 1
+	}
+	return count, kind
+}
+
+// deviceQueue holds the files waiting for a device's matchers. The router adds them to pending, which never blocks, and
+// the device's own goroutine passes them on to files, so a slow device's full channel doesn't hold up the others.
+type deviceQueue struct {
+	name    string
+	files   chan *repo.FileData
+	sent    uint32
+	lock    sync.Mutex
+	pending []*repo.FileData
+	closed  bool
+	ready   chan struct{}
+}
+
+// spawnDeviceMatchers routes files from the scanners to a queue per device, the matchers for each device are started
+// when its first file is found
+func (scanner *Scanner) spawnDeviceMatchers(ctx context.Context, matchers *sync.WaitGroup) {
+	matchers.Add(1)
+	go func() {
+		defer matchers.Done()
+		queues := make(map[uint64]*deviceQueue)
+		for file := range scanner.files {
+			queue, ok := queues[file.Device()]
+			if !ok {
+				queue = scanner.newDeviceQueue(ctx, matchers, file.Device())
+				queues[file.Device()] = queue
+			}
+			queue.add(file)
+		}
+		for _, queue := range queues {
+			queue.close()
+		}
+	}()
+}
+
+func (queue *deviceQueue) add(file *repo.FileData) {
+	queue.lock.Lock()
+	queue.pending = append(queue.pending, file)
+	queue.lock.Unlock()
+	queue.wake()
+}
+
+func (queue *deviceQueue) close() {
+	queue.lock.Lock()
+	queue.closed = true
+	queue.lock.Unlock()
+	queue.wake()
+}
+
+func (queue *deviceQueue) wake() {
+	select {
+	case queue.ready <- struct{}{}:
+	default:
+	}
+}
+
+// forward passes the pending files on to the device's matchers until the queue is closed and empty
+func (queue *deviceQueue) forward() {
+	defer close(queue.files)
+	for {
+		queue.lock.Lock()
+		batch, closed := queue.pending, queue.closed
+		queue.pending = nil
+		queue.lock.Unlock()
+		for _, file := range batch {
+			queue.files <- file
+			atomic.AddUint32(&queue.sent, 1)
+		}
+		if len(batch) == 0 {
+			if closed {
+				return
+			}
+			<-queue.ready
+		}
+	}
+}
+
+func (scanner *Scanner) newDeviceQueue(ctx context.Context, matchers *sync.WaitGroup, device uint64) *deviceQueue {
+	readers, kind := scanner.options.DeviceReaders.forDevice(device)
+	queue := &deviceQueue{
+		name:  fmt.Sprintf("files:%d", device),
+		files: make(chan *repo.FileData, scanner.options.MatchBuffer),
+		ready: make(chan struct{}, 1),
+	}
+	if scanner.options.Verbose {
+		fmt.Printf("device %d is %s, matching with %d readers\n", device, kind, readers)
+	}
+	scanner.queueLock.Lock()
+	scanner.deviceQueues = append(scanner.deviceQueues, queue)
+	scanner.queueLock.Unlock()
+	matchers.Add(1)
+	go func() {
+		defer matchers.Done()
+		queue.forward()
+	}()
+	for i := 0; i < readers; i++ {
+		matchers.Add(1)
+		go func(num int) {
+			defer matchers.Done()
+			scanner.matchWorker(ctx, num, queue.files)
+		}(i)
+	}
+	return queue
+}
@@ -0,0 +1,20 @@
+package dedupe
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// rotational reads the block device's queue settings from sysfs, partitions have them on their parent device
+func rotational(device uint64) (bool, bool) {
+	major := (device>>8)&0xfff | (device>>32)&^0xfff
+	minor := device&0xff | (device>>12)&^0xff
+	for _, path := range []string{"queue/rotational", "../queue/rotational"} {
+		data, err := ioutil.ReadFile(fmt.Sprintf("/sys/dev/block/%d:%d/%s", major, minor, path))
+		if err == nil {
+			return strings.TrimSpace(string(data)) == "1", true
+		}
+	}
+	return false, false
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+// +build !linux
+
+package dedupe
+
+// rotational isn't known here, so every device gets the non-rotational number of readers
+func rotational(device uint64) (bool, bool) {
+	return false, false
+}
@@ -0,0 +1,274 @@
+package dedupe
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/binary"
+	"fmt"
+	"github.com/glxxyz/dedupe/repo"
+	"github.com/glxxyz/dedupe/stats"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// externalGrouper keeps memory bounded for very large scans, files are written out to sorted spill files as they're
+// added, then merged so that only one size at a time is loaded into a MatchRepository
+type externalGrouper struct {
+	options    *matchOptions
+	statistics *stats.Stats
+
+	lock    sync.Mutex
+	records []record
+	spills  []string
+}
+
+// record is what's spilled for each file, enough to recreate its repo.FileData
+type record struct {
+	size    int64
+	modTime int64
+	path    string
+}
+
+func newExternalGrouper(options *matchOptions, statistics *stats.Stats) *externalGrouper {
+	return &externalGrouper{options: options, statistics: statistics}
+}
+
+func (grouper *externalGrouper) Add(file *repo.FileData) {
+	grouper.lock.Lock()
+	defer grouper.lock.Unlock()
+	grouper.records = append(grouper.records, record{file.Size(), file.ModTime().UnixNano(), file.Path()})
+	if len(grouper.records) >= grouper.options.options.SpillRecords {
+		grouper.spill()
+	}
+}
+
+func (grouper *externalGrouper) Groups(groups chan<- Group) {
+	grouper.lock.Lock()
+	defer grouper.lock.Unlock()
+	grouper.spill()
+	defer grouper.removeSpills()
+
+	merger, err := newMerger(grouper.spills)
+	if err != nil {
+		errLog.Printf("failed to open spill file: %v\n", err)
+		grouper.statistics.Error(stats.ErrorSpill)
+		return
+	}
+	defer merger.close()
+	var sameSize []record
+	for {
+		next, err := merger.next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			errLog.Printf("failed to read spill file: %v\n", err)
+			grouper.statistics.Error(stats.ErrorSpill)
+			return
+		}
+		if len(sameSize) > 0 && next.size != sameSize[0].size {
+			grouper.match(sameSize, groups)
+			sameSize = sameSize[:0]
+		}
+		// only directories are remembered by the walk, so a file reached twice is dropped here instead
+		if len(sameSize) == 0 || next.path != sameSize[len(sameSize)-1].path {
+			sameSize = append(sameSize, next)
+		}
+	}
+	grouper.match(sameSize, groups)
+}
+
+// match finds the duplicates amongst files of the same size, they're added by as many goroutines as matching uses
+func (grouper *externalGrouper) match(sameSize []record, groups chan<- Group) {
+	if len(sameSize) < 2 {
+		return
+	}
+	matchRepo := repo.NewMatchRepository(grouper.statistics)
+	records := make(chan record)
+	var matchers sync.WaitGroup
+	for i := 0; i < grouper.options.Matchers(); i++ {
+		matchers.Add(1)
+		go func() {
+			defer matchers.Done()
+			for r := range records {
+				matchRepo.Add(grouper.options, repo.RestoreFile(grouper.options, r.path, r.size, time.Unix(0, r.modTime)))
+			}
+		}()
+	}
+	for _, r := range sameSize {
+		records <- r
+	}
+	close(records)
+	matchers.Wait()
+	matchRepo.Groups(grouper.options, groups)
+}
+
+// spill must be called with the lock held
+func (grouper *externalGrouper) spill() {
+	if len(grouper.records) == 0 {
+		return
+	}
+	sort.Slice(grouper.records, func(i, j int) bool {
+		a, b := grouper.records[i], grouper.records[j]
+		if a.size != b.size {
+			return a.size < b.size
+		}
+		return a.path < b.path
+	})
+	path, err := writeSpill(grouper.options.options.TempDir, grouper.records)
+	if err != nil {
+		// the files can't be matched, but carry on with the rest
+		errLog.Printf("failed to write spill file: %v\n", err)
+		grouper.statistics.Error(stats.ErrorSpill)
+	} else {
+		if grouper.options.Verbose() {
+			fmt.Printf("spilled %d files to: %q\n", len(grouper.records), path)
+		}
+		grouper.spills = append(grouper.spills, path)
+	}
+	grouper.records = grouper.records[:0]
+}
+
+func (grouper *externalGrouper) removeSpills() {
+	for _, path := range grouper.spills {
+		if err := os.Remove(path); err != nil {
+			errLog.Printf("failed to remove spill file: %v\n", err)
+		}
+	}
+	grouper.spills = nil
+}
+
+func writeSpill(dir string, records []record) (string, error) {
+	file, err := ioutil.TempFile(dir, "dedupe-spill-")
+	if err != nil {
+		return "", err
+	}
+	writer := bufio.NewWriter(file)
+	for _, r := range records {
+		if err = writeRecord(writer, r); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = writer.Flush()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+	return file.Name(), nil
+}
+
+func writeRecord(w io.Writer, r record) error {
+	header := []int64{r.size, r.modTime, int64(len(r.path))}
+	if err := binary.Write(w, binary.LittleEndian, header); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, r.path)
+	return err
+}
+
+func readRecord(r io.Reader) (record, error) {
+	header := make([]int64, 3)
+	if err := binary.Read(r, binary.LittleEndian, header); err != nil {
+		return record{}, err
+	}
+	path := make([]byte, header[2])
+	if _, err := io.ReadFull(r, path); err != nil {
+		return record{}, err
+	}
+	return record{size: header[0], modTime: header[1], path: string(path)}, nil
+}
+
+// merger reads the sorted spill files back in a single sorted stream
+type merger struct {
+	files []*os.File
+	heads spillHeap
+}
+
+type spillHead struct {
+	record record
+	reader *bufio.Reader
+}
+
+func newMerger(paths []string) (*merger, error) {
+	m := &merger{}
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if err != nil {
+			m.close()
+			return nil, err
+		}
+		m.files = append(m.files, file)
+		reader := bufio.NewReader(file)
+		first, err := readRecord(reader)
+		if err == io.EOF {
+			continue
+		} else if err != nil {
+			m.close()
+			return nil, err
+		}
+		m.heads = append(m.heads, &spillHead{first, reader})
+	}
+	heap.Init(&m.heads)
+	return m, nil
+}
+
+// next returns io.EOF once every spill file has been read
+func (m *merger) next() (record, error) {
+	if len(m.heads) == 0 {
+		return record{}, io.EOF
+	}
+	head := m.heads[0]
+	result := head.record
+	next, err := readRecord(head.reader)
+	if err == io.EOF {
+		heap.Pop(&m.heads)
+	} else if err != nil {
+		return record{}, err
+	} else {
+		head.record = next
+		heap.Fix(&m.heads, 0)
+	}
+	return result, nil
+}
+
+func (m *merger) close() {
+	for _, file := range m.files {
+		file.Close()
+	}
+}
+
+type spillHeap []*spillHead
+
+func (h spillHeap) Len() int {
+	return len(h)
+}
+
+func (h spillHeap) Less(i, j int) bool {
+	if h[i].record.size != h[j].record.size {
+		return h[i].record.size < h[j].record.size
+	}
+	return h[i].record.path < h[j].record.path
+}
+
+func (h spillHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+}
+
+func (h *spillHeap) Push(x interface{}) {
+	*h = append(*h, x.(*spillHead))
+}
+
+func (h *spillHeap) Pop() interface{} {
+	old := *h
+	last := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return last
+}
@@ -0,0 +1,203 @@
+package dedupe
+
+import (
+	"fmt"
+	"github.com/glxxyz/dedupe/repo"
+	"github.com/glxxyz/dedupe/stats"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Filters is a chain of WalkFilters, a file is only scanned if each of them includes it. They're tried in order, so
+// the cheap ones should go first.
+type Filters []WalkFilter
+
+func (filters Filters) Include(path string, info os.FileInfo) bool {
+	return rejectedBy(filters, path, info) == nil
+}
+
+// rejectedBy returns the filter that leaves the file out, or nil. For a chain it's the one in the chain, so that
+// verbose mode can say which it was.
+func rejectedBy(filter WalkFilter, path string, info os.FileInfo) WalkFilter {
+	if filters, ok := filter.(Filters); ok {
+		for _, f := range filters {
+			if rejected := rejectedBy(f, path, info); rejected != nil {
+				return rejected
+			}
+		}
+		return nil
+	}
+	if filter != nil && !filter.Include(path, info) {
+		return filter
+	}
+	return nil
+}
+
+// BindFilters returns the chain with the filters that read files reading them with read and counting errors in
+// statistics, copied so that the filters passed in are left alone. A Scanner binds them to its matchers, this is for
+// filters used outside of one.
+func BindFilters(filter WalkFilter, read repo.ReadOptions, statistics *stats.Stats) WalkFilter {
+	switch f := filter.(type) {
+	case Filters:
+		bound := make(Filters, len(f))
+		for i := range f {
+			bound[i] = BindFilters(f[i], read, statistics)
+		}
+		return bound
+	case *typeFilter:
+		return &typeFilter{types: f.types, read: read, statistics: statistics}
+	}
+	return filter
+}
+
+// describeFilters lists the filters in a chain that can describe themselves
+func describeFilters(filter WalkFilter) []string {
+	if filters, ok := filter.(Filters); ok {
+		var descriptions []string
+		for _, f := range filters {
+			descriptions = append(descriptions, describeFilters(f)...)
+		}
+		return descriptions
+	}
+	if described, ok := filter.(fmt.Stringer); ok {
+		return []string{described.String()}
+	}
+	return nil
+}
+
+// the filters below only look at regular files, directories and symbolic links are always included
+
+type maxSizeFilter int64
+
+// MaxSize leaves out files bigger than bytes
+func MaxSize(bytes int64) WalkFilter {
+	return maxSizeFilter(bytes)
+}
+
+func (filter maxSizeFilter) Include(path string, info os.FileInfo) bool {
+	return !info.Mode().IsRegular() || info.Size() <= int64(filter)
+}
+
+func (filter maxSizeFilter) String() string {
+	return "max-size " + stats.HumanReadableSize(int64(filter))
+}
+
+type extensionFilter struct {
+	extensions map[string]bool
+	exclude    bool
+}
+
+// Extensions only includes files with one of the extensions, which can be given with or without the dot and match
+// in any case
+func Extensions(extensions []string) WalkFilter {
+	return newExtensionFilter(extensions, false)
+}
+
+// ExcludeExtensions leaves out files with any of the extensions
+func ExcludeExtensions(extensions []string) WalkFilter {
+	return newExtensionFilter(extensions, true)
+}
+
+func newExtensionFilter(extensions []string, exclude bool) *extensionFilter {
+	filter := &extensionFilter{extensions: make(map[string]bool, len(extensions)), exclude: exclude}
+	for _, extension := range extensions {
+		filter.extensions[strings.ToLower(strings.TrimPrefix(extension, "."))] = true
+	}
+	return filter
+}
+
+func (filter *extensionFilter) Include(path string, info os.FileInfo) bool {
+	if !info.Mode().IsRegular() {
+		return true
+	}
+	return filter.extensions[strings.ToLower(strings.TrimPrefix(filepath.Ext(path), "."))] != filter.exclude
+}
+
+func (filter *extensionFilter) String() string {
+	name := "ext"
+	if filter.exclude {
+		name = "exclude-ext"
+	}
+	return name + " " + strings.Join(sortedKeys(filter.extensions), ",")
+}
+
+type modifiedFilter struct {
+	after  time.Time
+	before time.Time
+}
+
+// Modified only includes files modified after and before the times, either can be zero to leave that end open
+func Modified(after time.Time, before time.Time) WalkFilter {
+	return &modifiedFilter{after: after, before: before}
+}
+
+func (filter *modifiedFilter) Include(path string, info os.FileInfo) bool {
+	if !info.Mode().IsRegular() {
+		return true
+	}
+	modified := info.ModTime()
+	return (filter.after.IsZero() || modified.After(filter.after)) &&
+		(filter.before.IsZero() || modified.Before(filter.before))
+}
+
+func (filter *modifiedFilter) String() string {
+	var bounds []string
+	if !filter.after.IsZero() {
+		bounds = append(bounds, "after "+filter.after.Format(time.RFC3339))
+	}
+	if !filter.before.IsZero() {
+		bounds = append(bounds, "before "+filter.before.Format(time.RFC3339))
+	}
+	return "modified " + strings.Join(bounds, " and ")
+}
+
+type typeFilter struct {
+	types      map[string]bool
+	read       repo.ReadOptions
+	statistics *stats.Stats
+}
+
+// unthrottled reads files when a filter isn't used by a Scanner
+type unthrottled struct{}
+
+func (unthrottled) Throttle() *repo.Throttle {
+	return nil
+}
+
+func (unthrottled) Background() bool {
+	return false
+}
+
+// FileTypes only includes files that repo.SniffType finds are one of the types, it reads the start of each file so
+// it's best after the other filters. A Scanner reads them with its throttle and counts any errors.
+func FileTypes(types []string) WalkFilter {
+	filter := &typeFilter{types: make(map[string]bool, len(types)), read: unthrottled{}}
+	for _, fileType := range types {
+		filter.types[fileType] = true
+	}
+	return filter
+}
+
+func (filter *typeFilter) Include(path string, info os.FileInfo) bool {
+	if !info.Mode().IsRegular() {
+		return true
+	}
+	fileType, err := repo.SniffType(filter.read, filter.statistics, path)
+	return err == nil && filter.types[fileType]
+}
+
+func (filter *typeFilter) String() string {
+	return "type " + strings.Join(sortedKeys(filter.types), ",")
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
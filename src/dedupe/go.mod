@@ -0,0 +1,13 @@
+module github.com/glxxyz/dedupe/dedupe
+
+go 1.15
+
+replace (
+	github.com/glxxyz/dedupe/repo v0.0.0 => ../repo
+	github.com/glxxyz/dedupe/stats v0.0.0 => ../stats
+)
+
+require (
+	github.com/glxxyz/dedupe/repo v0.0.0
+	github.com/glxxyz/dedupe/stats v0.0.0
+)
@@ -0,0 +1,57 @@
+package dedupe
+
+import (
+	"github.com/glxxyz/dedupe/repo"
+	"github.com/glxxyz/dedupe/stats"
+	"os"
+)
+
+// Group is a set of duplicate files in priority order, the first is the one to keep
+type Group = repo.Group
+
+// WalkFilter decides which files and directories are scanned, returning false for a directory skips all of it
+type WalkFilter interface {
+	Include(path string, info os.FileInfo) bool
+}
+
+type WalkFilterFunc func(path string, info os.FileInfo) bool
+
+func (f WalkFilterFunc) Include(path string, info os.FileInfo) bool {
+	return f(path, info)
+}
+
+// Grouper finds the duplicates amongst the scanned files, Add is called concurrently by the matchers and Groups
+// is called once after the last file has been added
+type Grouper interface {
+	Add(file *repo.FileData)
+	Groups(groups chan<- Group)
+}
+
+// Action is applied to each group of duplicates by the movers, before the group is sent to the caller of Scan
+type Action interface {
+	Apply(group Group)
+}
+
+type ActionFunc func(group Group)
+
+func (f ActionFunc) Apply(group Group) {
+	f(group)
+}
+
+// repoGrouper is the default Grouper, matching on attributes then hashes then contents
+type repoGrouper struct {
+	options   *matchOptions
+	matchRepo *repo.MatchRepository
+}
+
+func newRepoGrouper(options *matchOptions, statistics *stats.Stats) *repoGrouper {
+	return &repoGrouper{options: options, matchRepo: repo.NewMatchRepository(statistics)}
+}
+
+func (grouper *repoGrouper) Add(file *repo.FileData) {
+	grouper.matchRepo.Add(grouper.options, file)
+}
+
+func (grouper *repoGrouper) Groups(groups chan<- Group) {
+	grouper.matchRepo.Groups(grouper.options, groups)
+}
@@ -0,0 +1,206 @@
+package dedupe
+
+import (
+	"errors"
+	"fmt"
+	"github.com/glxxyz/dedupe/repo"
+	"github.com/glxxyz/dedupe/stats"
+	"sync"
+	"time"
+)
+
+// Options for a Scanner, start from DefaultOptions() and override what's needed
+type Options struct {
+	ModTime  bool          // compare file modification time
+	Name     bool          // compare file name
+	Size     bool          // compare file size
+	Hash     bool          // compare file hash, requires Size
+	Contents bool          // compare whole file contents, requires Hash
+	Samples  []repo.Sample // cheap hashes tried in order before the head hash, requires Hash
+	MinBytes int64         // minimum file size
+	SymLinks bool          // follow symbolic links, false ignores them
+	Verbose  bool          // emit verbose information on stdout
+	Scope    string        // which duplicates are acted on: repo.ScopeAll (also when empty), ScopeCrossRoot or ScopeWithinRoot
+
+	ScanBuffer  int // size of the buffer of roots waiting for scanners
+	Scanners    int // number of scanner goroutines
+	MatchBuffer int // size of the buffer of files waiting for matchers
+	Matchers    int // number of matcher goroutines
+	MoveBuffer  int // size of the buffer of groups waiting for movers
+	Movers      int // number of mover goroutines, these apply the Action
+
+	DeviceReaders DeviceReaders // optional, replaces Matchers with a number of matchers per device
+
+	MaxReadRate int64 // bytes per second read across all files, zero is unlimited
+	MaxIOPS     int64 // reads per second across all files, zero is unlimited
+	Background  bool  // drop files from the page cache once they've been read, where that's supported
+
+	Throttle *repo.Throttle // optional, shares the limits with reads outside the Scanner instead of MaxReadRate and MaxIOPS
+
+	External     bool   // bounded memory for very large scans, files are spilled to disk and matched one size at a time
+	SpillRecords int    // files held in memory before spilling when External is set
+	TempDir      string // where spill files are written, defaults to os.TempDir()
+
+	StateDir           string        // optional, checkpoints are saved here so the scan can be resumed
+	Resume             bool          // continue from the checkpoint in StateDir, if there is one
+	CheckpointInterval time.Duration // how often checkpoints are saved, as well as at the end
+
+	Filter  WalkFilter   // optional, decides which files are matched, Filters chains several
+	Grouper Grouper      // optional, defaults to grouping by the compare options above
+	Action  Action       // optional, applied to each group of duplicates
+	Stats   *stats.Stats // optional, created by Scan if not set
+}
+
+func DefaultOptions() Options {
+	return Options{
+		Size:        true,
+		Hash:        true,
+		ScanBuffer:  100,
+		Scanners:    10,
+		MatchBuffer: 100,
+		Matchers:    4,
+		MoveBuffer:  100,
+		Movers:      10,
+
+		SpillRecords: 1000000,
+
+		CheckpointInterval: time.Minute,
+	}
+}
+
+func (options *Options) validate() error {
+	if !(options.ModTime || options.Name || options.Size || options.Hash || options.Contents) {
+		return errors.New("at least one compare option must be true")
+	}
+	if options.Contents && !options.Hash {
+		return errors.New("when Contents is true then Hash must also be true")
+	}
+	if options.Hash && !options.Size {
+		return errors.New("when Hash is true then Size must also be true")
+	}
+	if len(options.Samples) > 0 && !options.Hash {
+		return errors.New("when Samples are set then Hash must be true")
+	}
+	for _, sample := range options.Samples {
+		switch sample.Kind {
+		case repo.SampleHead, repo.SampleTail, repo.SampleBlocks:
+		default:
+			return fmt.Errorf("unknown sample kind: %q", sample.Kind)
+		}
+		if sample.Bytes < 1 || (sample.Kind == repo.SampleBlocks && sample.Blocks < 1) {
+			return fmt.Errorf("sample %v must read at least one byte", sample)
+		}
+	}
+	switch options.Scope {
+	case "", repo.ScopeAll, repo.ScopeCrossRoot, repo.ScopeWithinRoot:
+	default:
+		return fmt.Errorf("unknown scope: %q", options.Scope)
+	}
+	if options.External && !options.Size {
+		return errors.New("when External is true then Size must also be true")
+	}
+	if options.External && options.SpillRecords < 1 {
+		return errors.New("when External is true then SpillRecords must be at least one")
+	}
+	if options.External && options.Grouper != nil {
+		return errors.New("External uses its own Grouper")
+	}
+	if options.Resume && options.StateDir == "" {
+		return errors.New("when Resume is true then StateDir must also be set")
+	}
+	if options.StateDir != "" && options.External {
+		return errors.New("StateDir can't be used along with External")
+	}
+	if options.StateDir != "" && options.CheckpointInterval <= 0 {
+		return errors.New("when StateDir is set then CheckpointInterval must be positive")
+	}
+	if options.DeviceReaders.Rotational < 0 || options.DeviceReaders.NonRotational < 0 {
+		return errors.New("device readers can't be negative")
+	}
+	if options.MaxReadRate < 0 || options.MaxIOPS < 0 {
+		return errors.New("read limits can't be negative")
+	}
+	if options.Scanners < 1 || options.Matchers < 1 || options.Movers < 1 {
+		return errors.New("at least one scanner, matcher and mover is needed")
+	}
+	if options.ScanBuffer < 0 || options.MatchBuffer < 0 || options.MoveBuffer < 0 {
+		return errors.New("buffer sizes can't be negative")
+	}
+	return nil
+}
+
+// matchOptions satisfies repo.MatchOptions, which also needs the roots for priority and a shared throttle
+type matchOptions struct {
+	options  *Options
+	roots    []string
+	throttle *repo.Throttle
+	readers  sync.Map // device -> int, so each device is only looked up once
+}
+
+func (match *matchOptions) ModTime() bool {
+	return match.options.ModTime
+}
+
+func (match *matchOptions) Name() bool {
+	return match.options.Name
+}
+
+func (match *matchOptions) Size() bool {
+	return match.options.Size
+}
+
+func (match *matchOptions) Hash() bool {
+	return match.options.Hash
+}
+
+func (match *matchOptions) Contents() bool {
+	return match.options.Contents
+}
+
+func (match *matchOptions) Samples() []repo.Sample {
+	return match.options.Samples
+}
+
+func (match *matchOptions) MinBytes() int64 {
+	return match.options.MinBytes
+}
+
+func (match *matchOptions) SymLinks() bool {
+	return match.options.SymLinks
+}
+
+func (match *matchOptions) Verbose() bool {
+	return match.options.Verbose
+}
+
+func (match *matchOptions) Throttle() *repo.Throttle {
+	return match.throttle
+}
+
+func (match *matchOptions) Background() bool {
+	return match.options.Background
+}
+
+func (match *matchOptions) Matchers() int {
+	return match.options.Matchers
+}
+
+func (match *matchOptions) DeviceReaders(device uint64) int {
+	if !match.options.DeviceReaders.enabled() {
+		return 0
+	}
+	if readers, ok := match.readers.Load(device); ok {
+		return readers.(int)
+	}
+	readers, _ := match.options.DeviceReaders.forDevice(device)
+	match.readers.Store(device, readers)
+	return readers
+}
+
+func (match *matchOptions) Paths() []string {
+	return match.roots
+}
+
+func (match *matchOptions) Scope() string {
+	return match.options.Scope
+}
@@ -0,0 +1,291 @@
+package dedupe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/glxxyz/dedupe/repo"
+	"github.com/glxxyz/dedupe/stats"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var errLog = log.New(os.Stderr, "", 0)
+
+// Scanner runs a single scan for duplicates, it can't be reused
+type Scanner struct {
+	options    Options
+	match      *matchOptions
+	grouper    Grouper
+	statistics *stats.Stats
+	state      *state
+	visitedMap sync.Map
+
+	scans  chan string
+	files  chan *repo.FileData
+	groups chan Group
+
+	queueLock    sync.Mutex
+	deviceQueues []*deviceQueue
+
+	scanCount  uint32
+	fileCount  uint32
+	groupCount uint32
+	started    uint32
+}
+
+func New(options Options) (*Scanner, error) {
+	if err := options.validate(); err != nil {
+		return nil, err
+	}
+	return &Scanner{options: options}, nil
+}
+
+// Scan starts scanning roots, highest priority first, and returns straight away. Each group of duplicates is sent
+// on the returned channel once the Action has been applied to it. The channel must be read until it's closed, which
+// happens soon after ctx is cancelled.
+func (scanner *Scanner) Scan(ctx context.Context, roots []string) (<-chan Group, error) {
+	if !atomic.CompareAndSwapUint32(&scanner.started, 0, 1) {
+		return nil, errors.New("a scanner can only be used once")
+	}
+	if len(roots) < 1 {
+		return nil, errors.New("at least one directory to scan must be passed in")
+	}
+	absoluteRoots := make([]string, len(roots))
+	for i, root := range roots {
+		absolute, err := filepath.Abs(root)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get an absolute path for %q: %w", root, err)
+		}
+		absoluteRoots[i] = absolute
+	}
+
+	state, err := newState(&scanner.options, absoluteRoots)
+	if err != nil {
+		return nil, err
+	}
+	scanner.state = state
+	scanner.match = &matchOptions{
+		options:  &scanner.options,
+		roots:    absoluteRoots,
+		throttle: scanner.options.Throttle,
+	}
+	if scanner.match.throttle == nil {
+		scanner.match.throttle = repo.NewThrottle(scanner.options.MaxReadRate, scanner.options.MaxIOPS)
+	}
+	scanner.statistics = scanner.options.Stats
+	if scanner.statistics == nil {
+		scanner.statistics = stats.New(absoluteRoots)
+	}
+	scanner.options.Filter = BindFilters(scanner.options.Filter, scanner.match, scanner.statistics)
+	scanner.grouper = scanner.options.Grouper
+	if scanner.options.External {
+		scanner.grouper = newExternalGrouper(scanner.match, scanner.statistics)
+	} else if scanner.grouper == nil {
+		scanner.grouper = newRepoGrouper(scanner.match, scanner.statistics)
+	}
+	scanner.scans = make(chan string, scanner.options.ScanBuffer)
+	scanner.files = make(chan *repo.FileData, scanner.options.MatchBuffer)
+	scanner.groups = make(chan Group, scanner.options.MoveBuffer)
+	results := make(chan Group)
+
+	if scanner.options.Verbose {
+		for _, filter := range describeFilters(scanner.options.Filter) {
+			fmt.Printf("filter: %s\n", filter)
+		}
+	}
+
+	go scanner.run(ctx, absoluteRoots, results)
+	return results, nil
+}
+
+// Stats are only available once Scan has been called
+func (scanner *Scanner) Stats() *stats.Stats {
+	return scanner.statistics
+}
+
+type ChannelStatus struct {
+	Name     string
+	Length   int
+	Capacity int
+	Sent     uint32
+}
+
+// ChannelStatus reports on the channels between each stage of the pipeline, once Scan has been called
+func (scanner *Scanner) ChannelStatus() []ChannelStatus {
+	channels := []ChannelStatus{
+		{"scans", len(scanner.scans), cap(scanner.scans), atomic.LoadUint32(&scanner.scanCount)},
+		{"files", len(scanner.files), cap(scanner.files), atomic.LoadUint32(&scanner.fileCount)},
+	}
+	scanner.queueLock.Lock()
+	for _, queue := range scanner.deviceQueues {
+		channels = append(channels, ChannelStatus{queue.name, len(queue.files), cap(queue.files), atomic.LoadUint32(&queue.sent)})
+	}
+	scanner.queueLock.Unlock()
+	return append(channels,
+		ChannelStatus{"groups", len(scanner.groups), cap(scanner.groups), atomic.LoadUint32(&scanner.groupCount)})
+}
+
+func (scanner *Scanner) run(ctx context.Context, roots []string, results chan<- Group) {
+	var scanners sync.WaitGroup
+	var matchers sync.WaitGroup
+	var movers sync.WaitGroup
+
+	scanner.statistics.StageStarted(stats.Scan)
+	scanner.statistics.StageStarted(stats.Match)
+	scanner.spawnScanners(ctx, &scanners)
+	scanner.spawnMatchers(ctx, &matchers)
+	scanner.spawnMovers(ctx, &movers, results)
+	scanner.seedScanners(roots)
+
+	stopTicker := scanner.spawnChannelTicker()
+	defer stopTicker()
+	stopCheckpointer := scanner.spawnCheckpointer()
+
+	close(scanner.scans)
+	scanners.Wait()
+	scanner.statistics.StageFinished(stats.Scan)
+	close(scanner.files)
+	matchers.Wait()
+	if ctx.Err() == nil {
+		scanner.statistics.StageStarted(stats.Move)
+		scanner.grouper.Groups(scanner.groups)
+	}
+	scanner.statistics.StageFinished(stats.Match)
+	// the last checkpoint has all of the hashes, so a finished scan can be resumed to rescan quickly
+	stopCheckpointer()
+	scanner.state.save(ctx.Err() == nil, scanner.statistics)
+	close(scanner.groups)
+	movers.Wait()
+	scanner.statistics.StageFinished(stats.Move)
+	close(results)
+}
+
+func (scanner *Scanner) spawnChannelTicker() func() {
+	if !scanner.options.Verbose {
+		return func() {}
+	}
+	ticker := time.NewTicker(time.Second)
+	done := make(chan bool)
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				channels := scanner.ChannelStatus()
+				fmt.Printf("Channels:\tlen/cap/count")
+				for _, channel := range channels {
+					fmt.Printf("\t%s=%d/%d/%d", channel.Name, channel.Length, channel.Capacity, channel.Sent)
+				}
+				fmt.Println()
+			case <-done:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+	}
+}
+
+func (scanner *Scanner) seedScanners(roots []string) {
+	for _, path := range roots {
+		scanner.scans <- path
+		atomic.AddUint32(&scanner.scanCount, 1)
+	}
+}
+
+func (scanner *Scanner) spawnScanners(ctx context.Context, scanners *sync.WaitGroup) {
+	for i := 0; i < scanner.options.Scanners; i++ {
+		scanners.Add(1)
+		go func(num int) {
+			defer scanners.Done()
+			scanner.scanWorker(ctx, num)
+		}(i)
+	}
+}
+
+func (scanner *Scanner) scanWorker(ctx context.Context, num int) {
+	if scanner.options.Verbose {
+		fmt.Printf("scanner %d starting\n", num)
+	}
+	for path := range scanner.scans {
+		scanner.walk(ctx, path)
+	}
+	if scanner.options.Verbose {
+		fmt.Printf("scanner %d done\n", num)
+	}
+}
+
+func (scanner *Scanner) spawnMatchers(ctx context.Context, matchers *sync.WaitGroup) {
+	if scanner.options.DeviceReaders.enabled() {
+		scanner.spawnDeviceMatchers(ctx, matchers)
+		return
+	}
+	for i := 0; i < scanner.options.Matchers; i++ {
+		matchers.Add(1)
+		go func(num int) {
+			defer matchers.Done()
+			scanner.matchWorker(ctx, num, scanner.files)
+		}(i)
+	}
+}
+
+func (scanner *Scanner) matchWorker(ctx context.Context, num int, files <-chan *repo.FileData) {
+	if scanner.options.Verbose {
+		fmt.Printf("matcher %d starting\n", num)
+	}
+	for file := range files {
+		// keep reading after cancellation so the scanners aren't blocked
+		if ctx.Err() != nil {
+			continue
+		}
+		if scanner.options.Verbose {
+			fmt.Printf("matcher %d working on file: %v\n", num, file.Path())
+		}
+		scanner.grouper.Add(file)
+	}
+	if scanner.options.Verbose {
+		fmt.Printf("matcher %d done\n", num)
+	}
+}
+
+func (scanner *Scanner) spawnMovers(ctx context.Context, movers *sync.WaitGroup, results chan<- Group) {
+	for i := 0; i < scanner.options.Movers; i++ {
+		movers.Add(1)
+		go func(num int) {
+			defer movers.Done()
+			scanner.moveWorker(ctx, num, results)
+		}(i)
+	}
+}
+
+func (scanner *Scanner) moveWorker(ctx context.Context, num int, results chan<- Group) {
+	if scanner.options.Verbose {
+		fmt.Printf("mover %d starting\n", num)
+	}
+	for group := range scanner.groups {
+		atomic.AddUint32(&scanner.groupCount, 1)
+		if ctx.Err() != nil {
+			continue
+		}
+		scanner.statistics.DuplicateGroup()
+		for _, file := range group.Duplicates() {
+			scanner.statistics.Duplicate(file.Path(), file.Size())
+		}
+		if scanner.options.Action != nil {
+			scanner.options.Action.Apply(group)
+		}
+		select {
+		case results <- group:
+		case <-ctx.Done():
+		}
+	}
+	if scanner.options.Verbose {
+		fmt.Printf("mover %d done\n", num)
+	}
+}
@@ -0,0 +1,387 @@
+package dedupe
+
+import (
+	"context"
+	"github.com/glxxyz/dedupe/repo"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	root := t.TempDir()
+	for rel, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+// collect returns each group as paths relative to root
+func collect(t *testing.T, root string, groups <-chan Group) [][]string {
+	var result [][]string
+	for group := range groups {
+		var paths []string
+		for _, file := range group.Files {
+			rel, err := filepath.Rel(root, file.Path())
+			if err != nil {
+				t.Fatal(err)
+			}
+			paths = append(paths, filepath.ToSlash(rel))
+		}
+		result = append(result, paths)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i][0] < result[j][0] })
+	return result
+}
+
+func testFiles() map[string]string {
+	return map[string]string{
+		"a/one.txt":    "one",
+		"a/two.txt":    "two",
+		"b/one.txt":    "one",
+		"b/two.jpg":    "two",
+		"c/one.txt":    "one",
+		"c/three.txt":  "three",
+		"c/skip/x.txt": "three",
+	}
+}
+
+func TestScan(t *testing.T) {
+	root := writeFiles(t, testFiles())
+	scanner, err := New(DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	groups, err := scanner.Scan(context.Background(),
+		[]string{filepath.Join(root, "c"), filepath.Join(root, "a"), filepath.Join(root, "b")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := collect(t, root, groups)
+	want := [][]string{
+		{"a/two.txt", "b/two.jpg"},
+		{"c/one.txt", "a/one.txt", "b/one.txt"},
+		{"c/skip/x.txt", "c/three.txt"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Scan() got %q, want %q", got, want)
+	}
+	if summary := scanner.Stats().Summary(); summary.DuplicateGroups != 3 || summary.Duplicates != 4 {
+		t.Errorf("Stats() found %d groups %d duplicates, want 3 groups 4 duplicates", summary.DuplicateGroups, summary.Duplicates)
+	}
+}
+
+func TestScanDeviceReaders(t *testing.T) {
+	root := writeFiles(t, testFiles())
+	options := DefaultOptions()
+	options.DeviceReaders = DeviceReaders{Rotational: 1, NonRotational: 2}
+	scanner, err := New(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	groups, err := scanner.Scan(context.Background(), []string{root})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := collect(t, root, groups)
+	if len(got) != 3 {
+		t.Errorf("Scan() got %q, want 3 groups", got)
+	}
+	var queued uint32
+	for _, channel := range scanner.ChannelStatus() {
+		if strings.HasPrefix(channel.Name, "files:") {
+			queued += channel.Sent
+		}
+	}
+	if queued != 7 {
+		t.Errorf("device queues were sent %d files, want all 7", queued)
+	}
+}
+
+func TestScanSharedThrottle(t *testing.T) {
+	root := writeFiles(t, testFiles())
+	options := DefaultOptions()
+	options.MaxReadRate = 1
+	options.Throttle = repo.NewThrottle(0, 1000)
+	scanner, err := New(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	groups, err := scanner.Scan(context.Background(), []string{root})
+	if err != nil {
+		t.Fatal(err)
+	}
+	collect(t, root, groups)
+	if scanner.match.Throttle() != options.Throttle {
+		t.Error("the scanner didn't read with the throttle it was given")
+	}
+}
+
+func TestDeviceQueueDoesntBlock(t *testing.T) {
+	queue := &deviceQueue{files: make(chan *repo.FileData, 1), ready: make(chan struct{}, 1)}
+	// nothing is reading the device's files, so a send to them would block the router
+	for i := 0; i < 10; i++ {
+		queue.add(&repo.FileData{})
+	}
+	go queue.forward()
+	queue.close()
+	received := 0
+	for range queue.files {
+		received++
+	}
+	if received != 10 || queue.sent != 10 {
+		t.Errorf("received %d files and sent %d, want 10", received, queue.sent)
+	}
+}
+
+func TestScanExternal(t *testing.T) {
+	root := writeFiles(t, testFiles())
+	spills := t.TempDir()
+	options := DefaultOptions()
+	options.External = true
+	options.SpillRecords = 2
+	options.TempDir = spills
+	options.SymLinks = true
+	if err := os.Symlink(filepath.Join(root, "a", "two.txt"), filepath.Join(root, "link.txt")); err != nil {
+		t.Fatal(err)
+	}
+	scanner, err := New(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	groups, err := scanner.Scan(context.Background(), []string{filepath.Join(root, "a"), root})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := collect(t, root, groups)
+	want := [][]string{
+		{"a/one.txt", "b/one.txt", "c/one.txt"},
+		{"a/two.txt", "b/two.jpg"},
+		{"c/skip/x.txt", "c/three.txt"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Scan() got %q, want %q", got, want)
+	}
+	if left, _ := ioutil.ReadDir(spills); len(left) != 0 {
+		t.Errorf("%d spill files left behind, want them all removed", len(left))
+	}
+}
+
+func TestScanResume(t *testing.T) {
+	root := writeFiles(t, testFiles())
+	options := DefaultOptions()
+	options.StateDir = t.TempDir()
+	scan := func(options Options) [][]string {
+		scanner, err := New(options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		groups, err := scanner.Scan(context.Background(), []string{root})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := collect(t, root, groups)
+		if cached := scanner.Stats().Summary().CachedHashes; options.Resume && cached == 0 {
+			t.Errorf("resumed scan didn't reuse any hashes from the checkpoint")
+		}
+		return got
+	}
+	scan(options)
+	options.Resume = true
+
+	// the same size but changed since the checkpoint, then a new file in a directory that was already walked
+	changed := filepath.Join(root, "c", "three.txt")
+	if err := ioutil.WriteFile(changed, []byte("thr3e"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(changed, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "b", "new.txt"), []byte("two"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	got := scan(options)
+	want := [][]string{
+		{"a/one.txt", "b/one.txt", "c/one.txt"},
+		{"a/two.txt", "b/new.txt", "b/two.jpg"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("resumed Scan() got %q, want %q", got, want)
+	}
+
+	options.MinBytes = 4
+	if scanner, err := New(options); err != nil {
+		t.Fatal(err)
+	} else if _, err := scanner.Scan(context.Background(), []string{root}); err == nil {
+		t.Error("Scan() resuming with different options succeeded, want an error")
+	}
+}
+
+func TestScanHooks(t *testing.T) {
+	root := writeFiles(t, testFiles())
+	options := DefaultOptions()
+	options.Filter = WalkFilterFunc(func(path string, info os.FileInfo) bool {
+		if info.IsDir() {
+			return info.Name() != "skip"
+		}
+		return strings.HasSuffix(path, ".txt")
+	})
+	var lock sync.Mutex
+	var applied []string
+	options.Action = ActionFunc(func(group Group) {
+		lock.Lock()
+		defer lock.Unlock()
+		for _, file := range group.Duplicates() {
+			applied = append(applied, filepath.Base(filepath.Dir(file.Path())))
+		}
+	})
+	scanner, err := New(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	groups, err := scanner.Scan(context.Background(), []string{root})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := collect(t, root, groups)
+	want := [][]string{{"a/one.txt", "b/one.txt", "c/one.txt"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Scan() got %q, want %q", got, want)
+	}
+	sort.Strings(applied)
+	if !reflect.DeepEqual(applied, []string{"b", "c"}) {
+		t.Errorf("Action applied to %q, want [b c]", applied)
+	}
+}
+
+func TestScanFilters(t *testing.T) {
+	root := writeFiles(t, map[string]string{
+		"a/one.txt":  "one",
+		"a/one.JPG":  "\xFF\xD8\xFF\xE0 one",
+		"a/big.jpg":  "\xFF\xD8\xFF\xE0 a big one",
+		"a/text.jpg": "not a photo",
+		"b/one.txt":  "one",
+		"b/one.jpg":  "\xFF\xD8\xFF\xE0 one",
+		"b/big.jpg":  "\xFF\xD8\xFF\xE0 a big one",
+		"b/text.jpg": "not a photo",
+		"b/old.jpg":  "\xFF\xD8\xFF\xE0 one",
+	})
+	old := time.Now().Add(-48 * time.Hour)
+	if err := os.Chtimes(filepath.Join(root, "b", "old.jpg"), old, old); err != nil {
+		t.Fatal(err)
+	}
+	options := DefaultOptions()
+	options.Filter = Filters{
+		MaxSize(10),
+		Extensions([]string{".jpg", "heic"}),
+		Modified(time.Now().Add(-24*time.Hour), time.Time{}),
+		FileTypes([]string{"image"}),
+	}
+	scanner, err := New(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	groups, err := scanner.Scan(context.Background(), []string{root})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := collect(t, root, groups)
+	want := [][]string{{"a/one.JPG", "b/one.jpg"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Scan() got %q, want %q", got, want)
+	}
+}
+
+func TestScanResumeFilters(t *testing.T) {
+	root := writeFiles(t, testFiles())
+	scan := func(filter WalkFilter, resume bool) ([][]string, error) {
+		options := DefaultOptions()
+		options.StateDir = filepath.Join(root, "..", "state")
+		options.Resume = resume
+		options.Filter = filter
+		scanner, err := New(options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		groups, err := scanner.Scan(context.Background(), []string{root})
+		if err != nil {
+			return nil, err
+		}
+		return collect(t, root, groups), nil
+	}
+	txt := WalkFilterFunc(func(path string, info os.FileInfo) bool {
+		return info.IsDir() || strings.HasSuffix(path, ".txt")
+	})
+	if _, err := scan(txt, false); err != nil {
+		t.Fatal(err)
+	}
+	// a filter that can't describe itself marks what it leaves out, so a wider one finds them when resuming
+	got, err := scan(nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"a/one.txt", "b/one.txt", "c/one.txt"},
+		{"a/two.txt", "b/two.jpg"},
+		{"c/skip/x.txt", "c/three.txt"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("resumed Scan() got %q, want %q", got, want)
+	}
+
+	// one that does is part of the checkpoint
+	if _, err := scan(Extensions([]string{"txt"}), false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := scan(Extensions([]string{"txt", "jpg"}), true); err == nil {
+		t.Error("Scan() resuming with a different filter succeeded, want an error")
+	}
+}
+
+func TestScanCancelled(t *testing.T) {
+	root := writeFiles(t, testFiles())
+	scanner, err := New(DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	groups, err := scanner.Scan(ctx, []string{root})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := collect(t, root, groups); len(got) != 0 {
+		t.Errorf("Scan() with cancelled context got %q, want no groups", got)
+	}
+	if _, err := scanner.Scan(context.Background(), []string{root}); err == nil {
+		t.Error("second Scan() succeeded, want an error")
+	}
+}
+
+func TestNewInvalidOptions(t *testing.T) {
+	for name, modify := range map[string]func(options *Options){
+		"no compare":            func(options *Options) { *options = Options{Scanners: 1, Matchers: 1, Movers: 1} },
+		"contents without hash": func(options *Options) { options.Contents, options.Hash = true, false },
+		"hash without size":     func(options *Options) { options.Size = false },
+		"no scanners":           func(options *Options) { options.Scanners = 0 },
+	} {
+		options := DefaultOptions()
+		modify(&options)
+		if _, err := New(options); err == nil {
+			t.Errorf("New() with %s succeeded, want an error", name)
+		}
+	}
+}
@@ -0,0 +1,310 @@
+package dedupe
+
+import (
+	"encoding/gob"
+	"fmt"
+	"github.com/glxxyz/dedupe/repo"
+	"github.com/glxxyz/dedupe/stats"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const checkpointFile = "checkpoint.gob"
+
+// checkpoint is what's saved to StateDir, files are only trusted while their size and modification time are the
+// same, and directories while their modification time is the same
+type checkpoint struct {
+	Fingerprint string
+	Dirs        map[string]*dirState // completely walked directories
+	Files       map[string]*fileState
+}
+
+type dirState struct {
+	ModTime int64
+	Dirs    []string
+	Files   []string
+}
+
+type fileState struct {
+	Size    int64
+	ModTime int64
+	Hashes  repo.FileHashes
+}
+
+// state keeps track of what's been found so it can be checkpointed, all methods are safe to call on a nil *state
+type state struct {
+	path        string
+	fingerprint string
+	verbose     bool
+	resumed     *checkpoint
+
+	lock  sync.Mutex
+	dirs  map[string]*dirState
+	files map[string]*trackedFile
+}
+
+type trackedFile struct {
+	file    *repo.FileData
+	modTime int64
+}
+
+// newState returns nil if there's no StateDir, when resuming without a checkpoint it starts from scratch
+func newState(options *Options, roots []string) (*state, error) {
+	if options.StateDir == "" {
+		return nil, nil
+	}
+	if err := os.MkdirAll(options.StateDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create state directory %q: %w", options.StateDir, err)
+	}
+	s := &state{
+		path:        filepath.Join(options.StateDir, checkpointFile),
+		fingerprint: fingerprint(options, roots),
+		verbose:     options.Verbose,
+		dirs:        make(map[string]*dirState),
+		files:       make(map[string]*trackedFile),
+	}
+	if !options.Resume {
+		return s, nil
+	}
+	resumed, err := readCheckpoint(s.path)
+	if os.IsNotExist(err) {
+		if options.Verbose {
+			fmt.Printf("no checkpoint to resume from in: %q\n", options.StateDir)
+		}
+		return s, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint %q: %w", s.path, err)
+	}
+	if resumed.Fingerprint != s.fingerprint {
+		return nil, fmt.Errorf("checkpoint %q is from a scan with different roots, compare options or filters", s.path)
+	}
+	if options.Verbose {
+		fmt.Printf("resuming from checkpoint with %d directories and %d files\n", len(resumed.Dirs), len(resumed.Files))
+	}
+	s.resumed = resumed
+	return s, nil
+}
+
+// fingerprint covers everything that changes which files are found and how they're hashed. Only the filters that
+// describe themselves are covered, the walk marks a directory partial when any of the others leaves something out.
+func fingerprint(options *Options, roots []string) string {
+	return fmt.Sprintf("roots=%q time=%v name=%v size=%v hash=%v contents=%v samples=%v min=%d symlinks=%v filters=%q",
+		roots, options.ModTime, options.Name, options.Size, options.Hash, options.Contents, options.Samples,
+		options.MinBytes, options.SymLinks, describeFilters(options.Filter))
+}
+
+// resumedDir returns the directory from the checkpoint being resumed, if it hasn't changed since
+func (s *state) resumedDir(path string, info os.FileInfo) *dirState {
+	if s == nil || s.resumed == nil {
+		return nil
+	}
+	if dir, ok := s.resumed.Dirs[path]; ok && dir.ModTime == info.ModTime().UnixNano() {
+		return dir
+	}
+	return nil
+}
+
+// fileFound restores the hashes from the checkpoint being resumed, if the file hasn't changed since
+func (s *state) fileFound(file *repo.FileData, info os.FileInfo) {
+	if s == nil {
+		return
+	}
+	modTime := info.ModTime().UnixNano()
+	if s.resumed != nil {
+		if saved, ok := s.resumed.Files[file.Path()]; ok && saved.Size == info.Size() && saved.ModTime == modTime {
+			file.SetHashes(saved.Hashes)
+		}
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.files[file.Path()] = &trackedFile{file: file, modTime: modTime}
+}
+
+func (s *state) dirFinished(dir *openDir) {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.dirs[dir.path] = &dirState{ModTime: dir.modTime, Dirs: dir.dirs, Files: dir.files}
+}
+
+// save writes a checkpoint, anything from the checkpoint being resumed that hasn't been reached yet is kept unless
+// the scan is complete
+func (s *state) save(complete bool, statistics *stats.Stats) {
+	if s == nil {
+		return
+	}
+	saved := &checkpoint{
+		Fingerprint: s.fingerprint,
+		Dirs:        make(map[string]*dirState),
+		Files:       make(map[string]*fileState),
+	}
+	if s.resumed != nil && !complete {
+		for path, dir := range s.resumed.Dirs {
+			saved.Dirs[path] = dir
+		}
+		for path, file := range s.resumed.Files {
+			saved.Files[path] = file
+		}
+	}
+	s.lock.Lock()
+	for path, dir := range s.dirs {
+		saved.Dirs[path] = dir
+	}
+	files := make(map[string]*trackedFile, len(s.files))
+	for path, tracked := range s.files {
+		files[path] = tracked
+	}
+	s.lock.Unlock()
+	// hashes are read without holding the lock, a file that's being hashed blocks until it's done
+	for path, tracked := range files {
+		saved.Files[path] = &fileState{Size: tracked.file.Size(), ModTime: tracked.modTime, Hashes: tracked.file.Hashes()}
+	}
+
+	if err := writeCheckpoint(s.path, saved); err != nil {
+		errLog.Printf("failed to write checkpoint %q: %v\n", s.path, err)
+		statistics.Error(stats.ErrorCheckpoint)
+	} else if s.verbose {
+		fmt.Printf("checkpoint saved with %d directories and %d files\n", len(saved.Dirs), len(saved.Files))
+	}
+}
+
+func readCheckpoint(path string) (*checkpoint, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var saved checkpoint
+	if err := gob.NewDecoder(file).Decode(&saved); err != nil {
+		return nil, err
+	}
+	return &saved, nil
+}
+
+// writeCheckpoint replaces the previous checkpoint in one go, so a crash part way through doesn't lose it
+func writeCheckpoint(path string, saved *checkpoint) error {
+	file, err := ioutil.TempFile(filepath.Dir(path), checkpointFile+".")
+	if err != nil {
+		return err
+	}
+	err = gob.NewEncoder(file).Encode(saved)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), path)
+	}
+	if err != nil {
+		os.Remove(file.Name())
+	}
+	return err
+}
+
+func (scanner *Scanner) spawnCheckpointer() func() {
+	if scanner.state == nil {
+		return func() {}
+	}
+	ticker := time.NewTicker(scanner.options.CheckpointInterval)
+	done := make(chan bool)
+	finished := make(chan bool)
+	go func() {
+		defer close(finished)
+		for {
+			select {
+			case <-ticker.C:
+				scanner.state.save(false, scanner.statistics)
+			case <-done:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-finished
+	}
+}
+
+// openDir is a directory that's still being walked, it's finished once the walk moves on to a path outside of it
+type openDir struct {
+	path    string
+	modTime int64
+	dirs    []string
+	files   []string
+	partial bool // something in it was skipped or failed, so it will have to be walked again
+}
+
+// dirStack follows a single filepath.Walk to find out when each directory has been completely walked
+type dirStack struct {
+	state *state
+	open  []*openDir
+}
+
+func (stack *dirStack) push(path string, info os.FileInfo) {
+	if stack.state == nil {
+		return
+	}
+	dir := &openDir{path: path, modTime: info.ModTime().UnixNano()}
+	if top := stack.top(); top != nil {
+		top.dirs = append(top.dirs, path)
+	}
+	stack.open = append(stack.open, dir)
+}
+
+func (stack *dirStack) addFile(path string) {
+	if top := stack.top(); top != nil {
+		top.files = append(top.files, path)
+	}
+}
+
+func (stack *dirStack) markPartial() {
+	if top := stack.top(); top != nil {
+		top.partial = true
+	}
+}
+
+// finishUntil finishes every open directory that doesn't contain path
+func (stack *dirStack) finishUntil(path string) {
+	for top := stack.top(); top != nil && !contains(top.path, path); top = stack.top() {
+		stack.pop()
+	}
+}
+
+func (stack *dirStack) finishAll() {
+	for stack.top() != nil {
+		stack.pop()
+	}
+}
+
+func (stack *dirStack) pop() {
+	dir := stack.open[len(stack.open)-1]
+	stack.open = stack.open[:len(stack.open)-1]
+	if dir.partial {
+		stack.markPartial()
+	} else {
+		stack.state.dirFinished(dir)
+	}
+}
+
+func (stack *dirStack) top() *openDir {
+	if len(stack.open) == 0 {
+		return nil
+	}
+	return stack.open[len(stack.open)-1]
+}
+
+func contains(dir string, path string) bool {
+	if path == dir {
+		return true
+	}
+	if !strings.HasSuffix(dir, string(filepath.Separator)) {
+		dir += string(filepath.Separator)
+	}
+	return strings.HasPrefix(path, dir)
+}
@@ -0,0 +1,128 @@
+package dedupe
+
+import (
+	"context"
+	"fmt"
+	"github.com/glxxyz/dedupe/repo"
+	"github.com/glxxyz/dedupe/stats"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+)
+
+func (scanner *Scanner) walk(ctx context.Context, root string) {
+	dirs := &dirStack{state: scanner.state}
+	err := filepath.Walk(root, scanner.walkFunc(ctx, dirs))
+	if err != nil && err != ctx.Err() {
+		errLog.Printf("error walking path %q: %v\n", root, err)
+		scanner.statistics.Error(stats.ErrorWalk)
+	} else if err == nil {
+		dirs.finishAll()
+	}
+}
+
+// walkFunc tracks which directories have been completely walked in dirs, when resuming a directory that hasn't
+// changed since the checkpoint only the files and directories that were found last time are walked
+func (scanner *Scanner) walkFunc(ctx context.Context, dirs *dirStack) filepath.WalkFunc {
+	options := &scanner.options
+	var walkFunc filepath.WalkFunc
+	walkFunc = func(path string, info os.FileInfo, err error) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		dirs.finishUntil(path)
+		if err != nil {
+			errLog.Printf("failed to access path %q: %v\n", path, err)
+			scanner.statistics.Error(stats.ErrorWalk)
+			dirs.markPartial()
+			return nil
+		}
+		if scanner.visited(path, info) {
+			if options.Verbose {
+				fmt.Printf("already visited: %q\n", path)
+			}
+			// it may not be visited this way round when resuming
+			dirs.markPartial()
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		} else if rejected := rejectedBy(options.Filter, path, info); rejected != nil {
+			described, ok := rejected.(fmt.Stringer)
+			if !ok {
+				// the checkpoint can't tell whether this filter would leave it out next time
+				dirs.markPartial()
+			}
+			if ok && options.Verbose {
+				fmt.Printf("filtered out by %v: %q\n", described, path)
+			} else if options.Verbose {
+				fmt.Printf("filtered out: %q\n", path)
+			}
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+		} else if info.IsDir() {
+			dirs.push(path, info)
+			if resumed := scanner.state.resumedDir(path, info); resumed != nil {
+				if options.Verbose {
+					fmt.Printf("resuming dir: %q\n", path)
+				}
+				for _, entry := range append(resumed.Files, resumed.Dirs...) {
+					if err := filepath.Walk(entry, walkFunc); err != nil {
+						return err
+					}
+				}
+				return filepath.SkipDir
+			}
+			if options.Verbose {
+				fmt.Printf("visiting dir: %q\n", path)
+			}
+		} else if info.Mode()&os.ModeSymlink != 0 {
+			// links are followed by a separate walk, so aren't part of this directory
+			dirs.markPartial()
+			scanner.walkSymLink(ctx, path)
+		} else if info.Size() < options.MinBytes {
+			if options.Verbose {
+				fmt.Printf("ignoring file size %v bytes: %q\n", info.Size(), path)
+			}
+		} else {
+			if options.Verbose {
+				fmt.Printf("visiting file: %q\n", path)
+			}
+			file := repo.NewFile(scanner.match, path, info)
+			scanner.state.fileFound(file, info)
+			dirs.addFile(path)
+			scanner.files <- file
+			atomic.AddUint32(&scanner.fileCount, 1)
+			scanner.statistics.FileScanned(path, info.Size())
+		}
+		return nil
+	}
+	return walkFunc
+}
+
+func (scanner *Scanner) walkSymLink(ctx context.Context, path string) {
+	if scanner.options.SymLinks {
+		dest, err := filepath.EvalSymlinks(path)
+		if err != nil {
+			errLog.Printf("failed to evaluate symbolic link %q: %v\n", path, err)
+			scanner.statistics.Error(stats.ErrorSymLink)
+		} else {
+			if scanner.options.Verbose {
+				fmt.Printf("following symbolic link: %q to %q\n", path, dest)
+			}
+			scanner.walk(ctx, dest)
+		}
+	} else if scanner.options.Verbose {
+		fmt.Printf("ignoring symbolic link: %q\n", path)
+	}
+}
+
+// visited only remembers directories in External mode, there are far fewer of them than files
+func (scanner *Scanner) visited(path string, info os.FileInfo) bool {
+	if scanner.options.External && !info.IsDir() {
+		return false
+	}
+	_, loaded := scanner.visitedMap.LoadOrStore(path, true)
+	return loaded
+}
@@ -0,0 +1,1409 @@
+package main_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// buildFlags are passed to 'go build' for the binary under test, race_test.go adds -race when needed
+var buildFlags []string
+
+var dedupeBinary string
+
+func TestMain(m *testing.M) {
+	os.Exit(buildAndRun(m))
+}
+
+func buildAndRun(m *testing.M) int {
+	dir, err := ioutil.TempDir("", "dedupe-e2e")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to create build directory: %v\n", err)
+		return 1
+	}
+	defer os.RemoveAll(dir)
+	dedupeBinary = filepath.Join(dir, "dedupe")
+	args := append([]string{"build", "-o", dedupeBinary}, buildFlags...)
+	build := exec.Command("go", append(args, ".")...)
+	if out, err := build.CombinedOutput(); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to build dedupe: %v\n%s", err, out)
+		return 1
+	}
+	return m.Run()
+}
+
+type result struct {
+	groups [][]string        // duplicate groups, highest priority first
+	moves  map[string]string // file moved -> destination, "" when not trashing
+	stdout string
+	stderr string
+}
+
+// runDedupe runs the binary and parses the 'Dupe:' and 'Move:' lines of its output
+func runDedupe(t *testing.T, args ...string) result {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(dedupeBinary, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("dedupe %v failed: %v\nstdout:\n%s\nstderr:\n%s", args, err, stdout.String(), stderr.String())
+	}
+	var dupes [][2]string
+	moves := make(map[string]string)
+	for _, line := range strings.Split(strings.TrimSpace(stdout.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		for i := range fields {
+			fields[i] = strings.Replace(fields[i], "\\ ", " ", -1)
+		}
+		switch {
+		case fields[0] == "Dupe:" && len(fields) == 3:
+			dupes = append(dupes, [2]string{fields[1], fields[2]})
+		case fields[0] == "Move:" && len(fields) == 2:
+			moves[fields[1]] = ""
+		case fields[0] == "Move:" && len(fields) == 3:
+			moves[fields[1]] = fields[2]
+		case fields[0] == "Skip:" || fields[0] == "Restore:" || fields[0] == "Extract:" || fields[0] == "Purge:" || fields[0] == "Unverified:":
+			// the other commands' output is checked in got.stdout
+		default:
+			t.Fatalf("unexpected output line: %q", line)
+		}
+	}
+	return result{groups: groupDupes(dupes), moves: moves, stdout: stdout.String(), stderr: stderr.String()}
+}
+
+// groupDupes joins the pairwise 'Dupe:' lines into groups, the order pairs are reported in varies between runs
+func groupDupes(dupes [][2]string) [][]string {
+	parent := make(map[string]string)
+	var find func(string) string
+	find = func(path string) string {
+		if p, ok := parent[path]; ok && p != path {
+			parent[path] = find(p)
+			return parent[path]
+		}
+		parent[path] = path
+		return path
+	}
+	lower := make(map[string]bool)
+	for _, dupe := range dupes {
+		parent[find(dupe[1])] = find(dupe[0])
+		lower[dupe[1]] = true
+	}
+	members := make(map[string][]string)
+	for path := range parent {
+		members[find(path)] = append(members[find(path)], path)
+	}
+	var groups [][]string
+	for _, group := range members {
+		sort.Slice(group, func(i, j int) bool {
+			// the kept file is never reported as the lower priority one
+			if lower[group[i]] != lower[group[j]] {
+				return !lower[group[i]]
+			}
+			return group[i] < group[j]
+		})
+		groups = append(groups, group)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i][0] < groups[j][0] })
+	return groups
+}
+
+var fixtureTime = time.Date(2020, time.July, 13, 12, 0, 0, 0, time.UTC)
+
+type fixture struct {
+	t    *testing.T
+	root string
+}
+
+func newFixture(t *testing.T) *fixture {
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &fixture{t: t, root: root}
+}
+
+func (f *fixture) path(rel string) string {
+	return filepath.Join(f.root, filepath.FromSlash(rel))
+}
+
+func (f *fixture) write(rel string, content []byte) {
+	f.t.Helper()
+	path := f.path(rel)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		f.t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, content, 0644); err != nil {
+		f.t.Fatal(err)
+	}
+	f.touch(rel, fixtureTime)
+}
+
+func (f *fixture) touch(rel string, modTime time.Time) {
+	f.t.Helper()
+	if err := os.Chtimes(f.path(rel), modTime, modTime); err != nil {
+		f.t.Fatal(err)
+	}
+}
+
+func (f *fixture) symlink(rel string, target string) {
+	f.t.Helper()
+	if err := os.Symlink(filepath.FromSlash(target), f.path(rel)); err != nil {
+		f.t.Skipf("can't create symbolic links: %v", err)
+	}
+}
+
+func (f *fixture) link(rel string, existing string) {
+	f.t.Helper()
+	if err := os.Link(f.path(existing), f.path(rel)); err != nil {
+		f.t.Skipf("can't create hard links: %v", err)
+	}
+}
+
+func (f *fixture) paths(rels ...string) []string {
+	paths := make([]string, len(rels))
+	for i, rel := range rels {
+		paths[i] = f.path(rel)
+	}
+	return paths
+}
+
+func (f *fixture) groups(groups ...[]string) [][]string {
+	var result [][]string
+	for _, group := range groups {
+		paths := f.paths(group...)
+		sort.Strings(paths[1:])
+		result = append(result, paths)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i][0] < result[j][0] })
+	return result
+}
+
+func content(seed string, size int) []byte {
+	return bytes.Repeat([]byte(seed), size/len(seed)+1)[:size]
+}
+
+// newPhotoFixture creates three roots with two duplicate groups spread across them:
+//
+//	long:  photos/a.jpg, "backup/a copy.jpg", backup/hardlink.jpg (a hard link to photos/a.jpg)
+//	short: photos/sub/b.txt, backup/b.txt, unsorted/ünïcödé.txt
+//
+// plus files that share size, head hash, or name with them without being duplicates
+func newPhotoFixture(t *testing.T) *fixture {
+	f := newFixture(t)
+	long := content("the quick brown fox jumps over the lazy dog ", 4000)
+	sameHead := append(append([]byte{}, long[:2000]...), content("different tail ", 2000)...)
+	short := content("short file ", 40)
+	f.write("photos/a.jpg", long)
+	f.write("photos/sub/b.txt", short)
+	f.write("photos/unique.txt", content("only in photos ", 40))
+	f.write("backup/a copy.jpg", long)
+	f.link("backup/hardlink.jpg", "photos/a.jpg")
+	f.write("backup/b.txt", short)
+	f.write("unsorted/ünïcödé.txt", short)
+	f.write("unsorted/same head.jpg", sameHead)
+	f.write("unsorted/sub/b.txt", content("same name and size ", 40))
+	return f
+}
+
+func (f *fixture) photoRoots() []string {
+	return f.paths("photos", "backup", "unsorted")
+}
+
+func movesWithoutTrash(paths []string) map[string]string {
+	moves := make(map[string]string)
+	for _, path := range paths {
+		moves[path] = ""
+	}
+	return moves
+}
+
+func assertResult(t *testing.T, got result, groups [][]string, moves map[string]string) {
+	t.Helper()
+	if groups == nil {
+		groups = [][]string{}
+	}
+	if got.groups == nil {
+		got.groups = [][]string{}
+	}
+	if !reflect.DeepEqual(got.groups, groups) {
+		t.Errorf("duplicate groups:\n got: %q\nwant: %q\noutput:\n%s", got.groups, groups, got.stdout)
+	}
+	if !reflect.DeepEqual(got.moves, moves) {
+		t.Errorf("moves:\n got: %q\nwant: %q\noutput:\n%s", got.moves, moves, got.stdout)
+	}
+}
+
+func TestCompareOptions(t *testing.T) {
+	tests := []struct {
+		name   string
+		args   []string
+		groups [][]string
+		moves  []string
+	}{
+		{
+			name: "defaults",
+			groups: [][]string{
+				{"photos/a.jpg", "backup/a copy.jpg", "backup/hardlink.jpg"},
+				{"photos/sub/b.txt", "backup/b.txt", "unsorted/ünïcödé.txt"},
+			},
+			moves: []string{"backup/a copy.jpg", "backup/hardlink.jpg", "backup/b.txt", "unsorted/ünïcödé.txt"},
+		},
+		{
+			name: "compare contents",
+			args: []string{"--compare-contents"},
+			groups: [][]string{
+				{"photos/a.jpg", "backup/a copy.jpg", "backup/hardlink.jpg"},
+				{"photos/sub/b.txt", "backup/b.txt", "unsorted/ünïcödé.txt"},
+			},
+			moves: []string{"backup/a copy.jpg", "backup/hardlink.jpg", "backup/b.txt", "unsorted/ünïcödé.txt"},
+		},
+		{
+			name: "sampling",
+			args: []string{"--sample=tail:64,blocks:2x16"},
+			groups: [][]string{
+				{"photos/a.jpg", "backup/a copy.jpg", "backup/hardlink.jpg"},
+				{"photos/sub/b.txt", "backup/b.txt", "unsorted/ünïcödé.txt"},
+			},
+			moves: []string{"backup/a copy.jpg", "backup/hardlink.jpg", "backup/b.txt", "unsorted/ünïcödé.txt"},
+		},
+		{
+			name: "external",
+			args: []string{"--external", "--spill-records=2"},
+			groups: [][]string{
+				{"photos/a.jpg", "backup/a copy.jpg", "backup/hardlink.jpg"},
+				{"photos/sub/b.txt", "backup/b.txt", "unsorted/ünïcödé.txt"},
+			},
+			moves: []string{"backup/a copy.jpg", "backup/hardlink.jpg", "backup/b.txt", "unsorted/ünïcödé.txt"},
+		},
+		{
+			name: "device readers",
+			args: []string{"--hdd-readers=1", "--ssd-readers=2"},
+			groups: [][]string{
+				{"photos/a.jpg", "backup/a copy.jpg", "backup/hardlink.jpg"},
+				{"photos/sub/b.txt", "backup/b.txt", "unsorted/ünïcödé.txt"},
+			},
+			moves: []string{"backup/a copy.jpg", "backup/hardlink.jpg", "backup/b.txt", "unsorted/ünïcödé.txt"},
+		},
+		{
+			name: "throttled in the background",
+			args: []string{"--max-read-rate=10M", "--max-iops=1000", "--background"},
+			groups: [][]string{
+				{"photos/a.jpg", "backup/a copy.jpg", "backup/hardlink.jpg"},
+				{"photos/sub/b.txt", "backup/b.txt", "unsorted/ünïcödé.txt"},
+			},
+			moves: []string{"backup/a copy.jpg", "backup/hardlink.jpg", "backup/b.txt", "unsorted/ünïcödé.txt"},
+		},
+		{
+			name:   "min size",
+			args:   []string{"--min-size=1K"},
+			groups: [][]string{{"photos/a.jpg", "backup/a copy.jpg", "backup/hardlink.jpg"}},
+			moves:  []string{"backup/a copy.jpg", "backup/hardlink.jpg"},
+		},
+		{
+			name:   "min size human readable float",
+			args:   []string{"--min-size=3.9K"},
+			groups: [][]string{{"photos/a.jpg", "backup/a copy.jpg", "backup/hardlink.jpg"}},
+			moves:  []string{"backup/a copy.jpg", "backup/hardlink.jpg"},
+		},
+		{
+			name:   "min size above all files",
+			args:   []string{"--min-size=1M"},
+			groups: nil,
+			moves:  nil,
+		},
+		{
+			name:   "compare name",
+			args:   []string{"--compare-name"},
+			groups: [][]string{{"photos/sub/b.txt", "backup/b.txt"}},
+			moves:  []string{"backup/b.txt"},
+		},
+		{
+			name:   "compare name without hash",
+			args:   []string{"--compare-name", "--compare-hash=false"},
+			groups: [][]string{{"photos/sub/b.txt", "backup/b.txt", "unsorted/sub/b.txt"}},
+			moves:  []string{"backup/b.txt", "unsorted/sub/b.txt"},
+		},
+		{
+			name: "size only",
+			args: []string{"--compare-hash=false"},
+			groups: [][]string{
+				{"photos/a.jpg", "backup/a copy.jpg", "backup/hardlink.jpg", "unsorted/same head.jpg"},
+				{"photos/sub/b.txt", "photos/unique.txt", "backup/b.txt", "unsorted/sub/b.txt", "unsorted/ünïcödé.txt"},
+			},
+			moves: []string{
+				"backup/a copy.jpg", "backup/hardlink.jpg", "unsorted/same head.jpg",
+				"photos/unique.txt", "backup/b.txt", "unsorted/sub/b.txt", "unsorted/ünïcödé.txt",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newPhotoFixture(t)
+			got := runDedupe(t, append(tt.args, f.photoRoots()...)...)
+			assertResult(t, got, f.groups(tt.groups...), movesWithoutTrash(f.paths(tt.moves...)))
+		})
+	}
+}
+
+func TestCompareTime(t *testing.T) {
+	f := newPhotoFixture(t)
+	f.touch("backup/a copy.jpg", fixtureTime.Add(time.Hour))
+	got := runDedupe(t, append([]string{"--compare-time"}, f.photoRoots()...)...)
+	assertResult(t, got,
+		f.groups(
+			[]string{"photos/a.jpg", "backup/hardlink.jpg"},
+			[]string{"photos/sub/b.txt", "backup/b.txt", "unsorted/ünïcödé.txt"}),
+		movesWithoutTrash(f.paths("backup/hardlink.jpg", "backup/b.txt", "unsorted/ünïcödé.txt")))
+}
+
+func TestRootPriority(t *testing.T) {
+	f := newPhotoFixture(t)
+	got := runDedupe(t, f.paths("unsorted", "backup", "photos")...)
+	assertResult(t, got,
+		f.groups(
+			[]string{"backup/a copy.jpg", "backup/hardlink.jpg", "photos/a.jpg"},
+			[]string{"unsorted/ünïcödé.txt", "backup/b.txt", "photos/sub/b.txt"}),
+		movesWithoutTrash(f.paths("backup/hardlink.jpg", "photos/a.jpg", "backup/b.txt", "photos/sub/b.txt")))
+}
+
+func TestScope(t *testing.T) {
+	f := newPhotoFixture(t)
+	tests := []struct {
+		scope  string
+		groups [][]string
+	}{
+		{"all", f.groups(
+			[]string{"photos/a.jpg", "backup/a copy.jpg", "backup/hardlink.jpg"},
+			[]string{"photos/sub/b.txt", "backup/b.txt", "unsorted/ünïcödé.txt"})},
+		// backup/b.txt and unsorted/ünïcödé.txt are each only a duplicate of the copy in photos
+		{"within-root", f.groups([]string{"backup/a copy.jpg", "backup/hardlink.jpg"})},
+		{"cross-root", f.groups(
+			[]string{"photos/a.jpg", "backup/a copy.jpg", "backup/hardlink.jpg"},
+			[]string{"photos/sub/b.txt", "backup/b.txt", "unsorted/ünïcödé.txt"})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.scope, func(t *testing.T) {
+			got := runDedupe(t, append([]string{"--scope=" + tt.scope}, f.photoRoots()...)...)
+			if !reflect.DeepEqual(got.groups, tt.groups) {
+				t.Errorf("duplicate groups:\n got: %q\nwant: %q", got.groups, tt.groups)
+			}
+		})
+	}
+
+	// with backup first it keeps a copy.jpg, so hardlink.jpg in the same root is left alone
+	got := runDedupe(t, "--scope=cross-root", f.path("backup"), f.path("photos"))
+	if want := f.groups([]string{"backup/a copy.jpg", "photos/a.jpg"}, []string{"backup/b.txt", "photos/sub/b.txt"}); !reflect.DeepEqual(got.groups, want) {
+		t.Errorf("cross-root groups:\n got: %q\nwant: %q", got.groups, want)
+	}
+}
+
+func TestFilters(t *testing.T) {
+	f := newFixture(t)
+	jpeg := "\xFF\xD8\xFF\xE0"
+	for rel, content := range map[string]string{
+		"a/photo.jpg": jpeg + "photo",
+		"b/photo.JPG": jpeg + "photo",
+		"a/notes.txt": "notes",
+		"b/notes.txt": "notes",
+		"a/fake.jpg":  "not a photo",
+		"b/fake.jpg":  "not a photo",
+		"a/big.jpg":   jpeg + strings.Repeat("big", 100),
+		"b/big.jpg":   jpeg + strings.Repeat("big", 100),
+		"a/old.jpg":   jpeg + "old",
+		"b/old.jpg":   jpeg + "old",
+	} {
+		f.write(rel, []byte(content))
+	}
+	old := time.Date(2010, 1, 1, 0, 0, 0, 0, time.Local)
+	f.touch("a/old.jpg", old)
+	f.touch("b/old.jpg", old)
+	roots := []string{f.path("a"), f.path("b")}
+	tests := []struct {
+		name   string
+		args   []string
+		groups [][]string
+	}{
+		{"max-size", []string{"--max-size=100"}, f.groups(
+			[]string{"a/fake.jpg", "b/fake.jpg"},
+			[]string{"a/notes.txt", "b/notes.txt"},
+			[]string{"a/old.jpg", "b/old.jpg"},
+			[]string{"a/photo.jpg", "b/photo.JPG"})},
+		{"ext", []string{"--ext=txt"}, f.groups([]string{"a/notes.txt", "b/notes.txt"})},
+		{"exclude-ext", []string{"--exclude-ext=.JPG"}, f.groups([]string{"a/notes.txt", "b/notes.txt"})},
+		{"newer-than", []string{"--newer-than=2015-01-01", "--ext=jpg"}, f.groups(
+			[]string{"a/big.jpg", "b/big.jpg"},
+			[]string{"a/fake.jpg", "b/fake.jpg"},
+			[]string{"a/photo.jpg", "b/photo.JPG"})},
+		{"older-than", []string{"--older-than=2015-01-01"}, f.groups([]string{"a/old.jpg", "b/old.jpg"})},
+		{"type", []string{"--type=image", "--max-size=100", "--newer-than=2015-01-01T00:00:00"}, f.groups([]string{"a/photo.jpg", "b/photo.JPG"})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := runDedupe(t, append(tt.args, roots...)...)
+			if !reflect.DeepEqual(got.groups, tt.groups) {
+				t.Errorf("duplicate groups:\n got: %q\nwant: %q", got.groups, tt.groups)
+			}
+		})
+	}
+
+	// trash purge's --older-than means something else, so each is set for its own command
+	cmd := exec.Command(dedupeBinary, append([]string{"--ext=txt"}, roots...)...)
+	cmd.Env = append(os.Environ(), "DEDUPE_TRASH_PURGE_OLDER_THAN=2015-01-01")
+	if out, err := cmd.Output(); err != nil || !strings.Contains(string(out), f.path("b/notes.txt")) {
+		t.Errorf("dedupe with $DEDUPE_TRASH_PURGE_OLDER_THAN didn't find the duplicate: %v\n%s", err, out)
+	}
+	cmd = exec.Command(dedupeBinary, append([]string{"--ext=txt"}, roots...)...)
+	cmd.Env = append(os.Environ(), "DEDUPE_SCAN_OLDER_THAN=2015-01-01")
+	if out, err := cmd.Output(); err != nil || strings.Contains(string(out), f.path("b/notes.txt")) {
+		t.Errorf("dedupe with $DEDUPE_SCAN_OLDER_THAN found a file modified since: %v\n%s", err, out)
+	}
+
+	out, err := exec.Command(dedupeBinary, append([]string{"--verbose", "--ext=jpg", "--type=image"}, roots...)...).CombinedOutput()
+	if err != nil {
+		t.Fatalf("dedupe --verbose failed: %v\n%s", err, out)
+	}
+	for _, want := range []string{
+		"filter: ext jpg\n",
+		"filter: type image\n",
+		fmt.Sprintf("filtered out by ext jpg: %q\n", f.path("a/notes.txt")),
+		fmt.Sprintf("filtered out by type image: %q\n", f.path("a/fake.jpg")),
+	} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("verbose output doesn't contain %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestNoDuplicates(t *testing.T) {
+	f := newPhotoFixture(t)
+	got := runDedupe(t, f.path("unsorted"))
+	assertResult(t, got, nil, map[string]string{})
+}
+
+// newLinkFixture creates a root with symbolic links to a file and a directory outside of it
+func newLinkFixture(t *testing.T) *fixture {
+	f := newFixture(t)
+	f.write("root/a.txt", content("linked content ", 100))
+	f.write("root/b.txt", content("other content ", 100))
+	f.write("outside/a copy.txt", content("linked content ", 100))
+	f.symlink("root/file link.txt", "../outside/a copy.txt")
+	f.symlink("root/dir link", "../outside")
+	f.symlink("root/self link", ".")
+	return f
+}
+
+func TestSymbolicLinks(t *testing.T) {
+	t.Run("ignored by default", func(t *testing.T) {
+		f := newLinkFixture(t)
+		got := runDedupe(t, f.path("root"))
+		assertResult(t, got, nil, map[string]string{})
+	})
+	t.Run("followed", func(t *testing.T) {
+		f := newLinkFixture(t)
+		got := runDedupe(t, "--follow-symlinks", f.path("root"))
+		assertResult(t, got,
+			f.groups([]string{"root/a.txt", "outside/a copy.txt"}),
+			movesWithoutTrash(f.paths("outside/a copy.txt")))
+	})
+}
+
+func TestTrash(t *testing.T) {
+	f := newPhotoFixture(t)
+	trash := f.path("trash")
+	if err := os.Mkdir(trash, 0755); err != nil {
+		t.Fatal(err)
+	}
+	moved := f.paths("backup/a copy.jpg", "backup/hardlink.jpg", "backup/b.txt", "unsorted/ünïcödé.txt")
+	moves := make(map[string]string)
+	for _, path := range moved {
+		moves[path] = filepath.Join(trash, path)
+	}
+
+	got := runDedupe(t, append([]string{"--trash=" + trash}, f.photoRoots()...)...)
+	assertResult(t, got,
+		f.groups(
+			[]string{"photos/a.jpg", "backup/a copy.jpg", "backup/hardlink.jpg"},
+			[]string{"photos/sub/b.txt", "backup/b.txt", "unsorted/ünïcödé.txt"}),
+		moves)
+
+	for _, path := range moved {
+		if _, err := os.Lstat(path); !os.IsNotExist(err) {
+			t.Errorf("expected %q to be moved, but got: %v", path, err)
+		}
+	}
+	var trashed []string
+	err := filepath.Walk(trash, func(path string, info os.FileInfo, err error) error {
+		if err == nil && info.IsDir() && info.Name() == ".dedupe" {
+			return filepath.SkipDir
+		}
+		if err == nil && !info.IsDir() {
+			trashed = append(trashed, path)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want []string
+	for _, dest := range moves {
+		want = append(want, dest)
+	}
+	sort.Strings(trashed)
+	sort.Strings(want)
+	if !reflect.DeepEqual(trashed, want) {
+		t.Errorf("trash contents:\n got: %q\nwant: %q", trashed, want)
+	}
+	for _, kept := range f.paths("photos/a.jpg", "photos/sub/b.txt", "photos/unique.txt", "unsorted/same head.jpg", "unsorted/sub/b.txt") {
+		if _, err := os.Stat(kept); err != nil {
+			t.Errorf("expected %q to be kept: %v", kept, err)
+		}
+	}
+
+	// a second run finds nothing left to move
+	assertResult(t, runDedupe(t, append([]string{"--trash=" + trash}, f.photoRoots()...)...), nil, map[string]string{})
+}
+
+func TestReportApplyRestore(t *testing.T) {
+	f := newPhotoFixture(t)
+	trash := f.path("trash")
+	if err := os.Mkdir(trash, 0755); err != nil {
+		t.Fatal(err)
+	}
+	report := f.path("report.json")
+	runDedupe(t, append([]string{"report", "--format=json", "--output=" + report, "--summary=none"}, f.photoRoots()...)...)
+	if got := runDedupe(t, "verify", report); !strings.Contains(got.stderr, "all 4 duplicates in the report verified") {
+		t.Errorf("verify didn't check all 4 duplicates:\n%s", got.stderr)
+	}
+
+	// the same size but different contents, so it has to be left alone
+	f.write("unsorted/ünïcödé.txt", content("changed file ", 40))
+	var stdout bytes.Buffer
+	verify := exec.Command(dedupeBinary, "verify", report)
+	verify.Stdout = &stdout
+	if err := verify.Run(); err == nil {
+		t.Error("verify succeeded after a duplicate changed, expected failure")
+	}
+	if want := "Stale:\t" + f.path("unsorted/ünïcödé.txt") + "\tcontents changed\n"; stdout.String() != want {
+		t.Errorf("verify output:\n got: %q\nwant: %q", stdout.String(), want)
+	}
+
+	moved := f.paths("backup/a copy.jpg", "backup/hardlink.jpg", "backup/b.txt")
+	moves := make(map[string]string)
+	for _, path := range moved {
+		moves[path] = filepath.Join(trash, path)
+	}
+	assertResult(t, runDedupe(t, "apply", "--trash="+trash, report), nil, moves)
+
+	got := runDedupe(t, "restore", "--trash="+trash, f.path("backup"))
+	if !strings.Contains(got.stderr, "restored 3 files, 0 left in the trash") {
+		t.Errorf("restore output:\n%s%s", got.stdout, got.stderr)
+	}
+	for _, path := range moved {
+		if _, err := os.Lstat(path); err != nil {
+			t.Errorf("expected %q to be restored: %v", path, err)
+		}
+	}
+
+	runDedupe(t, append([]string{"scan", "--trash=" + trash}, f.photoRoots()...)...)
+	runDedupe(t, "trash", "purge", "--trash="+trash)
+	if left, err := ioutil.ReadDir(trash); err != nil || len(left) != 0 {
+		t.Errorf("trash not empty after purge: %v %v", left, err)
+	}
+	for _, path := range moved {
+		if _, err := os.Lstat(path); !os.IsNotExist(err) {
+			t.Errorf("expected %q to be purged, but got: %v", path, err)
+		}
+	}
+}
+
+func TestTrashVerifyPurge(t *testing.T) {
+	f := newPhotoFixture(t)
+	trash := f.path("trash")
+	if err := os.Mkdir(trash, 0755); err != nil {
+		t.Fatal(err)
+	}
+	runDedupe(t, append([]string{"--trash=" + trash}, f.photoRoots()...)...)
+	if got := runDedupe(t, "trash", "verify", "--trash="+trash, "--max-read-rate=100M", "--background"); !strings.Contains(got.stderr, "all 4 files in the trash verified") {
+		t.Errorf("trash verify didn't check all 4 files:\n%s", got.stderr)
+	}
+
+	// the short files' kept copy changes, so their duplicates in the trash have to stay there
+	f.write("photos/sub/b.txt", content("changed file ", 40))
+	var stdout bytes.Buffer
+	verify := exec.Command(dedupeBinary, "trash", "verify", "--trash="+trash)
+	verify.Stdout = &stdout
+	if err := verify.Run(); err == nil {
+		t.Error("trash verify succeeded after a kept file changed, expected failure")
+	}
+	if lines := strings.Count(stdout.String(), "\tkept file changed\n"); lines != 2 {
+		t.Errorf("trash verify found %d changed, want 2:\n%s", lines, stdout.String())
+	}
+
+	got := runDedupe(t, "trash", "purge", "--trash="+trash, "--older-than=1d")
+	if !strings.Contains(got.stderr, "purged 0 files 0 from the trash, 4 left") {
+		t.Errorf("purge of files older than a day:\n%s", got.stderr)
+	}
+	got = runDedupe(t, "trash", "purge", "--trash="+trash)
+	if !strings.Contains(got.stderr, "purged 2 files 7.8K from the trash, 2 left") || !strings.Contains(got.stderr, "Run ") {
+		t.Errorf("purge output:\n%s", got.stderr)
+	}
+	for _, path := range f.paths("backup/a copy.jpg", "backup/hardlink.jpg") {
+		if _, err := os.Lstat(filepath.Join(trash, path)); !os.IsNotExist(err) {
+			t.Errorf("expected %q to be purged, but got: %v", path, err)
+		}
+	}
+	for _, path := range f.paths("backup/b.txt", "unsorted/ünïcödé.txt") {
+		if _, err := os.Lstat(filepath.Join(trash, path)); err != nil {
+			t.Errorf("expected %q to be left in the trash: %v", path, err)
+		}
+	}
+}
+
+func TestXDGTrash(t *testing.T) {
+	f := newPhotoFixture(t)
+	defer os.Setenv("XDG_DATA_HOME", os.Getenv("XDG_DATA_HOME"))
+	os.Setenv("XDG_DATA_HOME", f.path("data"))
+	trash := f.path("data/Trash")
+	// something else called b.txt is already in the trash
+	f.write("data/Trash/info/b.txt.trashinfo", []byte("[Trash Info]\nPath=/b.txt\nDeletionDate=2020-07-13T12:00:00\n"))
+
+	got := runDedupe(t, append([]string{"--trash=xdg:"}, f.photoRoots()...)...)
+	if len(got.moves) != 4 {
+		t.Fatalf("moved %d files to the desktop trash, want 4: %q", len(got.moves), got.moves)
+	}
+	names := make(map[string]bool)
+	for original, trashed := range got.moves {
+		if filepath.Dir(trashed) != filepath.Join(trash, "files") {
+			t.Errorf("%q was moved to %q, want it in the home trash", original, trashed)
+		}
+		names[filepath.Base(trashed)] = true
+		info, err := ioutil.ReadFile(filepath.Join(trash, "info", filepath.Base(trashed)+".trashinfo"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		escaped := (&url.URL{Path: filepath.ToSlash(original)}).EscapedPath()
+		if !strings.HasPrefix(string(info), "[Trash Info]\nPath="+escaped+"\nDeletionDate=") {
+			t.Errorf("trash info for %q:\n%s", original, info)
+		}
+	}
+	if !names["b.2.txt"] {
+		t.Errorf("trashed names are %v, want b.2.txt as b.txt is taken", names)
+	}
+
+	runDedupe(t, "restore", "--trash=xdg:")
+	for original := range got.moves {
+		if _, err := os.Lstat(original); err != nil {
+			t.Errorf("expected %q to be restored: %v", original, err)
+		}
+	}
+	if left, err := ioutil.ReadDir(filepath.Join(trash, "files")); err != nil || len(left) != 0 {
+		t.Errorf("trash not empty after restore: %v %v", left, err)
+	}
+	if left, err := ioutil.ReadDir(filepath.Join(trash, "info")); err != nil || len(left) != 1 {
+		t.Errorf("trash info should only have b.txt after restore: %v %v", left, err)
+	}
+}
+
+func TestTrashLayouts(t *testing.T) {
+	keeps := map[string]string{
+		"backup/a copy.jpg":    "photos/a.jpg",
+		"backup/hardlink.jpg":  "photos/a.jpg",
+		"backup/b.txt":         "photos/sub/b.txt",
+		"unsorted/ünïcödé.txt": "photos/sub/b.txt",
+	}
+	for _, tt := range []struct {
+		layout string
+		// where checks the file is somewhere in the trash that the layout puts it
+		where func(trash string, trashed string, path string, keep string) bool
+	}{
+		{"mirror", func(trash string, trashed string, path string, keep string) bool {
+			return trashed == filepath.Join(trash, path)
+		}},
+		{"dated", func(trash string, trashed string, path string, keep string) bool {
+			run := strings.TrimSuffix(trashed, path)
+			return filepath.Dir(run) == trash && len(filepath.Base(run)) == len("2006-01-02T150405")
+		}},
+		{"flat", func(trash string, trashed string, path string, keep string) bool {
+			return filepath.Dir(trashed) == trash && strings.HasSuffix(trashed, "-"+filepath.Base(path))
+		}},
+		{"group", func(trash string, trashed string, path string, keep string) bool {
+			group := filepath.Dir(trashed)
+			return filepath.Dir(group) == trash && strings.HasSuffix(group, "-"+filepath.Base(keep)) &&
+				filepath.Base(trashed) == filepath.Base(path)
+		}},
+	} {
+		t.Run(tt.layout, func(t *testing.T) {
+			f := newPhotoFixture(t)
+			trash := f.path("trash")
+			if err := os.Mkdir(trash, 0755); err != nil {
+				t.Fatal(err)
+			}
+			got := runDedupe(t, append([]string{"--trash=" + trash, "--trash-layout=" + tt.layout}, f.photoRoots()...)...)
+			if len(got.moves) != len(keeps) {
+				t.Fatalf("moved %d files, want %d: %q", len(got.moves), len(keeps), got.moves)
+			}
+			groups := make(map[string]string)
+			for path, keep := range keeps {
+				trashed := got.moves[f.path(path)]
+				if !tt.where(trash, trashed, f.path(path), f.path(keep)) {
+					t.Errorf("%q was moved to %q", path, trashed)
+				}
+				if _, err := os.Lstat(trashed); err != nil {
+					t.Errorf("expected %q in the trash: %v", trashed, err)
+				}
+				groups[filepath.Dir(trashed)] = keep
+			}
+			if tt.layout == "group" && len(groups) != 2 {
+				t.Errorf("want a directory for each of the 2 groups, got: %q", groups)
+			}
+
+			runDedupe(t, "restore", "--trash="+trash)
+			for path := range keeps {
+				if _, err := os.Lstat(f.path(path)); err != nil {
+					t.Errorf("expected %q to be restored: %v", path, err)
+				}
+			}
+			if left, err := ioutil.ReadDir(trash); err != nil || len(left) != 0 {
+				t.Errorf("trash not empty after restore: %v %v", left, err)
+			}
+		})
+	}
+}
+
+func TestTrashCollision(t *testing.T) {
+	for _, tt := range []struct {
+		collision string
+		moved     string // where the second backup/b.txt goes in the trash, or "" if it's left alone
+		stderr    string
+	}{
+		{"suffix", "backup/b.2.txt", ""},
+		{"skip", "", ""},
+		{"overwrite-if-identical", "backup/b.txt", ""},
+		{"error", "", "not moving: "},
+	} {
+		t.Run(tt.collision, func(t *testing.T) {
+			f := newPhotoFixture(t)
+			trash := f.path("trash")
+			if err := os.Mkdir(trash, 0755); err != nil {
+				t.Fatal(err)
+			}
+			runDedupe(t, append([]string{"--trash=" + trash}, f.photoRoots()...)...)
+			f.write("backup/b.txt", content("short file ", 40))
+
+			got := runDedupe(t, append([]string{"--trash=" + trash, "--on-collision=" + tt.collision}, f.photoRoots()...)...)
+			want := map[string]string{}
+			if tt.moved != "" {
+				want[f.path("backup/b.txt")] = filepath.Join(trash, f.path(tt.moved))
+			}
+			if !reflect.DeepEqual(got.moves, want) {
+				t.Errorf("moves:\n got: %q\nwant: %q", got.moves, want)
+			}
+			if _, err := os.Lstat(f.path("backup/b.txt")); (err == nil) != (tt.moved == "") {
+				t.Errorf("backup/b.txt should be moved: %v, but got: %v", tt.moved != "", err)
+			}
+			if !strings.Contains(got.stderr, tt.stderr) {
+				t.Errorf("stderr doesn't contain %q:\n%s", tt.stderr, got.stderr)
+			}
+		})
+	}
+}
+
+func TestTrashCollisionIdenticalRestore(t *testing.T) {
+	f := newFixture(t)
+	data := content("same name and contents ", 3000)
+	for _, rel := range []string{"photos/x.txt", "backup/x.txt", "unsorted/x.txt"} {
+		f.write(rel, data)
+	}
+	trash := f.path("trash")
+	if err := os.Mkdir(trash, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// the group layout puts both duplicates at the same path, so the second run shares what the first trashed
+	args := []string{"--trash=" + trash, "--trash-layout=group", "--on-collision=overwrite-if-identical", f.path("photos")}
+	first := runDedupe(t, append(args, f.path("backup"))...)
+	trashed := first.moves[f.path("backup/x.txt")]
+	before, err := os.Lstat(trashed)
+	if err != nil {
+		t.Fatalf("expected backup/x.txt in the trash: %v", err)
+	}
+	second := runDedupe(t, append(args, f.path("unsorted"))...)
+	if second.moves[f.path("unsorted/x.txt")] != trashed {
+		t.Fatalf("expected unsorted/x.txt moved to: %q, got: %q", trashed, second.moves)
+	}
+	if after, err := os.Lstat(trashed); err != nil || !os.SameFile(before, after) {
+		t.Errorf("expected the file in the trash to be left alone: %v", err)
+	}
+	for _, rel := range []string{"backup/x.txt", "unsorted/x.txt"} {
+		if _, err := os.Lstat(f.path(rel)); !os.IsNotExist(err) {
+			t.Errorf("expected %q to be moved: %v", rel, err)
+		}
+	}
+
+	runDedupe(t, "restore", "--trash="+trash)
+	for _, rel := range []string{"backup/x.txt", "unsorted/x.txt"} {
+		if restored, err := ioutil.ReadFile(f.path(rel)); err != nil || !bytes.Equal(restored, data) {
+			t.Errorf("expected %q to be restored: %v", rel, err)
+		}
+	}
+	if left, err := ioutil.ReadDir(trash); err != nil || len(left) != 0 {
+		t.Errorf("trash not empty after restore: %v %v", left, err)
+	}
+}
+
+func TestTrashStore(t *testing.T) {
+	f := newPhotoFixture(t)
+	trash := f.path("trash")
+	if err := os.Mkdir(trash, 0755); err != nil {
+		t.Fatal(err)
+	}
+	stored := func(data []byte) string {
+		digest := fmt.Sprintf("%x", sha256.Sum256(data))
+		return filepath.Join(trash, digest[:2], digest[2:4], digest)
+	}
+	long, err := ioutil.ReadFile(f.path("photos/a.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	short := content("short file ", 40)
+	moves := map[string]string{
+		f.path("backup/a copy.jpg"):    stored(long),
+		f.path("backup/hardlink.jpg"):  stored(long),
+		f.path("backup/b.txt"):         stored(short),
+		f.path("unsorted/ünïcödé.txt"): stored(short),
+	}
+	got := runDedupe(t, append([]string{"--trash=" + trash, "--trash-layout=store"}, f.photoRoots()...)...)
+	if !reflect.DeepEqual(got.moves, moves) {
+		t.Errorf("moves:\n got: %q\nwant: %q", got.moves, moves)
+	}
+	if left, err := ioutil.ReadDir(trash); err != nil || len(left) != 3 {
+		t.Errorf("want one copy of each content in the trash along with the journal: %v %v", left, err)
+	}
+
+	runDedupe(t, "trash", "extract", "--trash="+trash, f.path("backup"))
+	for _, path := range f.paths("backup/a copy.jpg", "backup/hardlink.jpg", "backup/b.txt") {
+		if data, err := ioutil.ReadFile(path); err != nil {
+			t.Errorf("expected %q to be extracted: %v", path, err)
+		} else if stored(data) != moves[path] {
+			t.Errorf("%q was extracted with the wrong contents", path)
+		}
+		if _, err := os.Lstat(moves[path]); err != nil {
+			t.Errorf("expected %q to still be in the trash after extracting %q: %v", moves[path], path, err)
+		}
+		if err := os.Remove(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got = runDedupe(t, "restore", "--trash="+trash)
+	if !strings.Contains(got.stderr, "restored 4 files, 0 left in the trash") {
+		t.Errorf("restore output:\n%s%s", got.stdout, got.stderr)
+	}
+	for path, trashed := range moves {
+		if data, err := ioutil.ReadFile(path); err != nil {
+			t.Errorf("expected %q to be restored: %v", path, err)
+		} else if stored(data) != trashed {
+			t.Errorf("%q was restored with the wrong contents", path)
+		}
+	}
+	if left, err := ioutil.ReadDir(trash); err != nil || len(left) != 0 {
+		t.Errorf("trash not empty after restore: %v %v", left, err)
+	}
+
+	runDedupe(t, append([]string{"--trash=" + trash, "--trash-layout=store"}, f.photoRoots()...)...)
+	got = runDedupe(t, "trash", "purge", "--trash="+trash)
+	// each content is only reclaimed once
+	if !strings.Contains(got.stderr, "purged 4 files 3.9K from the trash, 0 left") {
+		t.Errorf("purge output:\n%s", got.stderr)
+	}
+	if left, err := ioutil.ReadDir(trash); err != nil || len(left) != 0 {
+		t.Errorf("trash not empty after purge: %v %v", left, err)
+	}
+}
+
+func TestEmitScript(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("no sh to run the script with")
+	}
+	f := newPhotoFixture(t)
+	trash := f.path("trash")
+	if err := os.Mkdir(trash, 0755); err != nil {
+		t.Fatal(err)
+	}
+	awkward := "unsorted/-n $HOME 'it's' \"q\"\nx.txt"
+	f.write(awkward, content("short file ", 40))
+	moved := f.paths("backup/a copy.jpg", "backup/hardlink.jpg", "backup/b.txt", "unsorted/ünïcödé.txt", awkward)
+
+	var stdout, stderr bytes.Buffer
+	emit := exec.Command(dedupeBinary, append([]string{"--emit-script=sh", "--trash=" + trash}, f.photoRoots()...)...)
+	emit.Stdout = &stdout
+	emit.Stderr = &stderr
+	if err := emit.Run(); err != nil {
+		t.Fatalf("emit-script failed: %v\n%s", err, stderr.String())
+	}
+	for _, path := range moved {
+		if _, err := os.Lstat(path); err != nil {
+			t.Errorf("expected %q to be left for the script to move: %v", path, err)
+		}
+	}
+	script := f.path("dedupe.sh")
+	if err := ioutil.WriteFile(script, stdout.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// a second run has nothing left to move, and mustn't fail
+	for run := 0; run < 2; run++ {
+		if out, err := exec.Command(sh, script).CombinedOutput(); err != nil {
+			t.Fatalf("script failed: %v\n%s\nscript:\n%s", err, out, stdout.String())
+		}
+	}
+	for _, path := range moved {
+		if _, err := os.Lstat(path); !os.IsNotExist(err) {
+			t.Errorf("expected %q to be moved, but got: %v", path, err)
+		}
+		if _, err := os.Lstat(filepath.Join(trash, path)); err != nil {
+			t.Errorf("expected %q in the trash: %v", path, err)
+		}
+	}
+
+	// the script writes the journal as it goes, so what it moved can be restored
+	out, err := exec.Command(dedupeBinary, "restore", "--trash="+trash).CombinedOutput()
+	if err != nil || !strings.Contains(string(out), "restored 5 files, 0 left in the trash") {
+		t.Errorf("restore failed: %v\n%s", err, out)
+	}
+}
+
+func TestHooks(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no sh to run the hooks with")
+	}
+	f := newPhotoFixture(t)
+	trash := f.path("trash")
+	if err := os.Mkdir(trash, 0755); err != nil {
+		t.Fatal(err)
+	}
+	log := f.path("moves.jsonl")
+	got := runDedupe(t, append([]string{
+		"--trash=" + trash,
+		// the group of photos is vetoed
+		`--on-duplicate=case "$DEDUPE_KEEP" in *.jpg) exit 1;; esac`,
+		"--on-move=cat >> '" + log + "'; [ \"$DEDUPE_FILE\" != '" + f.path("backup/b.txt") + "' ]",
+	}, f.photoRoots()...)...)
+	moves := map[string]string{f.path("unsorted/ünïcödé.txt"): filepath.Join(trash, f.path("unsorted/ünïcödé.txt"))}
+	if !reflect.DeepEqual(got.moves, moves) {
+		t.Errorf("moves:\n got: %q\nwant: %q\noutput:\n%s", got.moves, moves, got.stdout)
+	}
+	for _, vetoed := range []string{"backup/a copy.jpg\tvetoed by on-duplicate", "backup/b.txt\tvetoed by on-move"} {
+		if !strings.Contains(got.stdout, "Skip:\t"+f.path(vetoed)) {
+			t.Errorf("output doesn't skip %q:\n%s", vetoed, got.stdout)
+		}
+	}
+
+	data, err := ioutil.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var files []string
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var event struct {
+			Event string `json:"event"`
+			Keep  string `json:"keep"`
+			File  string `json:"file"`
+		}
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Fatalf("on-move stdin isn't JSON: %q: %v", line, err)
+		}
+		if event.Event != "move" || event.Keep != f.path("photos/sub/b.txt") {
+			t.Errorf("on-move event: %q", line)
+		}
+		files = append(files, event.File)
+	}
+	sort.Strings(files)
+	if want := f.paths("backup/b.txt", "unsorted/ünïcödé.txt"); !reflect.DeepEqual(files, want) {
+		t.Errorf("on-move ran for %q, want %q", files, want)
+	}
+
+	got = runDedupe(t, append([]string{"--trash=" + trash, "--on-move=exec sleep 5", "--hook-timeout=100ms"}, f.photoRoots()...)...)
+	if len(got.moves) != 0 || !strings.Contains(got.stderr, "on-move timed out after 100ms") {
+		t.Errorf("hooks that time out should veto the moves: %q\n%s", got.moves, got.stderr)
+	}
+}
+
+func TestUniques(t *testing.T) {
+	f := newPhotoFixture(t)
+	out := f.path("out")
+	if err := os.Mkdir(out, 0755); err != nil {
+		t.Fatal(err)
+	}
+	uniques := f.paths("unsorted/same head.jpg", "unsorted/sub/b.txt")
+	for _, tt := range []struct {
+		name  string
+		args  []string
+		moved bool
+	}{
+		{"list", nil, false},
+		{"copy", []string{"--copy-to=" + out}, false},
+		{"move", []string{"--move-to=" + out}, true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			cmd := exec.Command(dedupeBinary, append(append([]string{"uniques"}, tt.args...), f.photoRoots()...)...)
+			cmd.Stdout = &stdout
+			cmd.Stderr = &stderr
+			if err := cmd.Run(); err != nil {
+				t.Fatalf("uniques failed: %v\n%s", err, stderr.String())
+			}
+			want := f.path("unsorted") + ":\n\tsame head.jpg\n\n" + f.path("unsorted/sub") + ":\n\tb.txt\n"
+			if stdout.String() != want {
+				t.Errorf("uniques output:\n got: %q\nwant: %q", stdout.String(), want)
+			}
+			if !strings.Contains(stderr.String(), "2 unique files 3.9K in 2 directories") {
+				t.Errorf("uniques summary:\n%s", stderr.String())
+			}
+			for _, path := range uniques {
+				if _, err := os.Lstat(path); (err == nil) == tt.moved {
+					t.Errorf("%q should be moved: %v, but got: %v", path, tt.moved, err)
+				}
+				if _, err := os.Lstat(filepath.Join(out, path)); (err == nil) != (tt.args != nil) {
+					t.Errorf("%q should be in %q: %v, but got: %v", path, out, tt.args != nil, err)
+				}
+			}
+			// the copies are in the way of the files being moved there
+			if tt.name == "copy" {
+				for _, path := range uniques {
+					if err := os.Remove(filepath.Join(out, path)); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestCompare(t *testing.T) {
+	for _, tt := range []struct {
+		layout string
+		merged []string
+	}{
+		{"", nil},
+		{"mirror", []string{"a/new.txt", "a/sub/new2.txt", "a/dated/old.txt"}},
+		{"by-date", []string{"a/2015/06/new.txt", "a/2015/06/new2.txt", "a/2015/06/old.txt"}},
+		{"flat", []string{"a/new.txt", "a/new2.txt", "a/old.txt"}},
+	} {
+		t.Run(tt.layout, func(t *testing.T) {
+			f := newFixture(t)
+			for rel, content := range map[string]string{
+				"a/x.txt":         "one",
+				"a/sub/y.txt":     "two",
+				"a/z.txt":         "three",
+				"a/c.txt":         "cA",
+				"b/x.txt":         "one",
+				"b/moved/y.txt":   "two",
+				"b/c.txt":         "cB",
+				"b/new.txt":       "four",
+				"b/sub/new2.txt":  "five",
+				"b/dated/old.txt": "six",
+			} {
+				f.write(rel, []byte(content))
+				f.touch(rel, time.Date(2015, 6, 1, 12, 0, 0, 0, time.Local))
+			}
+			args := []string{"compare"}
+			if tt.layout != "" {
+				args = append(args, "--merge", "--merge-layout="+tt.layout)
+			}
+			var stdout, stderr bytes.Buffer
+			cmd := exec.Command(dedupeBinary, append(args, f.path("a"), f.path("b"))...)
+			cmd.Stdout = &stdout
+			cmd.Stderr = &stderr
+			if err := cmd.Run(); err != nil {
+				t.Fatalf("compare failed: %v\n%s", err, stderr.String())
+			}
+			want := "Same:\tsub/y.txt\tmoved/y.txt\n" +
+				"Same:\tx.txt\n" +
+				"Changed:\tc.txt\n" +
+				"Only in A:\tz.txt\n" +
+				"Only in B:\tdated/old.txt\n" +
+				"Only in B:\tnew.txt\n" +
+				"Only in B:\tsub/new2.txt\n"
+			if stdout.String() != filepath.FromSlash(want) {
+				t.Errorf("compare output:\n got: %q\nwant: %q", stdout.String(), want)
+			}
+			if !strings.Contains(stderr.String(), "2 same, 1 changed, 1 only in A, 3 only in B") {
+				t.Errorf("compare summary:\n%s", stderr.String())
+			}
+			for _, path := range f.paths(tt.merged...) {
+				if _, err := os.Lstat(path); err != nil {
+					t.Errorf("%q should be merged: %v", path, err)
+				}
+			}
+		})
+	}
+}
+
+func TestCatalog(t *testing.T) {
+	f := newFixture(t)
+	for rel, content := range map[string]string{
+		"tree/2015/a.jpg":   "a",
+		"tree/2015/b.jpg":   "b",
+		"tree/notes.txt":    "notes",
+		"tree/old.txt":      "old",
+		"tree/unsorted.jpg": "c",
+	} {
+		f.write(rel, []byte(content))
+	}
+	catalog := f.path("tree/catalog.json")
+	if out, err := exec.Command(dedupeBinary, "catalog", "create", "--output="+catalog, f.path("tree")).CombinedOutput(); err != nil {
+		t.Fatalf("catalog create failed: %v\n%s", err, out)
+	}
+	// reorganise the tree
+	for from, to := range map[string]string{
+		"tree/2015/a.jpg":   "tree/photos/2015/a.jpg",
+		"tree/unsorted.jpg": "tree/photos/2015/c.jpg",
+	} {
+		if err := os.MkdirAll(filepath.Dir(f.path(to)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(f.path(from), f.path(to)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f.write("tree/notes.txt", []byte("more notes"))
+	f.write("tree/photos/2015/b.jpg", []byte("b"))
+	f.write("tree/new.txt", []byte("new"))
+	if err := os.Remove(f.path("tree/old.txt")); err != nil {
+		t.Fatal(err)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(dedupeBinary, "catalog", "diff", "--max-read-rate=1M", "--background", catalog, f.path("tree"))
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("catalog diff failed: %v\n%s", err, stderr.String())
+	}
+	want := "renamed: 2015/a.jpg -> photos/2015/a.jpg\n" +
+		"renamed: unsorted.jpg -> photos/2015/c.jpg\n" +
+		"changed: notes.txt\n" +
+		"added: catalog.json\n" +
+		"added: new.txt\n" +
+		"added: photos/2015/b.jpg\n" +
+		"removed: old.txt\n"
+	if stdout.String() != want {
+		t.Errorf("catalog diff output:\n got: %q\nwant: %q", stdout.String(), want)
+	}
+	if !strings.Contains(stderr.String(), "2 renamed, 1 changed, 3 added, 1 removed") {
+		t.Errorf("catalog diff summary:\n%s", stderr.String())
+	}
+}
+
+func TestCatalogFilters(t *testing.T) {
+	f := newFixture(t)
+	for rel, content := range map[string]string{
+		"tree/a.jpg":      "photo a",
+		"tree/b.JPG":      "photo b",
+		"tree/tiny.jpg":   "t",
+		"tree/notes.txt":  "notes",
+		"other/a.jpg":     "photo a",
+		"other/notes.txt": "other notes",
+	} {
+		f.write(rel, []byte(content))
+	}
+	out, err := exec.Command(dedupeBinary, "catalog", "create", "--ext=jpg", "--min-size=2", f.path("tree")).Output()
+	if err != nil {
+		t.Fatalf("catalog create failed: %v", err)
+	}
+	var paths []string
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		var entry struct {
+			Path string `json:"path"`
+		}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("catalog line %q: %v", line, err)
+		}
+		paths = append(paths, entry.Path)
+	}
+	sort.Strings(paths)
+	if want := []string{"a.jpg", "b.JPG"}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("catalogued %v, want %v", paths, want)
+	}
+	out, err = exec.Command(dedupeBinary, "catalog", "diff", "--exclude-ext=txt", f.path("tree"), f.path("other")).Output()
+	if err != nil {
+		t.Fatalf("catalog diff failed: %v", err)
+	}
+	if want := "removed: b.JPG\nremoved: tiny.jpg\n"; string(out) != want {
+		t.Errorf("catalog diff output:\n got: %q\nwant: %q", out, want)
+	}
+}
+
+func TestInvalidOptions(t *testing.T) {
+	f := newPhotoFixture(t)
+	for _, args := range [][]string{
+		{"--compare-size=false", f.path("photos")},
+		{"--compare-contents", "--compare-hash=false", f.path("photos")},
+		{"--min-size=abc", f.path("photos")},
+		{"--trash=" + f.path("missing"), f.path("photos")},
+		{"--resume", f.path("photos")},
+		{"--max-read-rate=fast", f.path("photos")},
+		{"--verbose"},
+		{"apply", f.path("report.json")},
+		{"verify"},
+		{"trash", "empty", "--trash=" + f.path("photos")},
+		{"trash", "purge", "--trash=" + f.path("photos"), "--older-than=month"},
+		{"--trash=" + f.path("photos"), "--trash-layout=tree", f.path("unsorted")},
+		{"--trash=xdg:", "--on-collision=skip", f.path("unsorted")},
+		{"trash", "extract", "--trash=" + f.path("photos")},
+		{"--emit-script=bash", "--trash=" + f.path("photos"), f.path("unsorted")},
+		{"--emit-script=sh", f.path("unsorted")},
+		{"--emit-script=sh", "--trash=" + f.path("photos"), "--on-collision=overwrite-if-identical", f.path("unsorted")},
+		{"--emit-script=sh", "--trash=" + f.path("photos"), "--on-collision=error", f.path("unsorted")},
+		{"--hook-concurrency=0", f.path("unsorted")},
+		{"--scope=everything", f.path("unsorted")},
+		{"uniques", f.path("unsorted")},
+		{"uniques", "--copy-to=" + f.path("photos"), "--move-to=" + f.path("photos"), f.path("photos"), f.path("unsorted")},
+		{"compare", f.path("photos")},
+		{"compare", f.path("photos"), f.path("photos/2015")},
+		{"compare", "--merge-layout=tree", f.path("photos"), f.path("unsorted")},
+		{"catalog", "create", f.path("report.json")},
+		{"catalog", "diff", f.path("photos")},
+		{"catalog", "create", "--max-iops=-1", f.path("photos")},
+		{"catalog", "create", "--type=spreadsheet", f.path("photos")},
+		{"--max-size=1K", "--min-size=2K", f.path("photos")},
+		{"--newer-than=2020-02-01", "--older-than=2020-01-01", f.path("photos")},
+		{"--newer-than=last-week", f.path("photos")},
+		{"--type=spreadsheet", f.path("photos")},
+		{"help", "nonsense"},
+	} {
+		if err := exec.Command(dedupeBinary, args...).Run(); err == nil {
+			t.Errorf("dedupe %q succeeded, expected failure", args)
+		}
+	}
+}
+
+func TestConfig(t *testing.T) {
+	f := newPhotoFixture(t)
+	configHome := f.path("config")
+	if err := os.MkdirAll(filepath.Join(configHome, "dedupe"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	quoted := make([]string, 0, 3)
+	for _, root := range f.photoRoots() {
+		quoted = append(quoted, strconv.Quote(root))
+	}
+	config := "min-size = 1 # overridden by the environment\n\n[profiles.photos]\nscanners = 2\npaths = [" +
+		strings.Join(quoted, ", ") + "]\n"
+	if err := ioutil.WriteFile(filepath.Join(configHome, "dedupe", "config.toml"), []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	run := func(args ...string) string {
+		var stdout, stderr bytes.Buffer
+		cmd := exec.Command(dedupeBinary, args...)
+		cmd.Dir = configHome
+		cmd.Env = append(os.Environ(), "XDG_CONFIG_HOME="+configHome, "DEDUPE_MIN_SIZE=100")
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			t.Fatalf("dedupe %v failed: %v\nstderr:\n%s", args, err, stderr.String())
+		}
+		return stdout.String()
+	}
+
+	printed := run("--profile=photos", "--movers=3", "--print-config")
+	for _, want := range []string{
+		`min-size = "100"  # environment`,
+		"scanners = 2  # profile photos in ",
+		"movers = 3  # command line",
+		"matchers = 4  # default",
+		"paths = [" + strings.Join(quoted, ", ") + "]  # profile photos in ",
+	} {
+		if !strings.Contains(printed, want) {
+			t.Errorf("--print-config is missing %q:\n%s", want, printed)
+		}
+	}
+
+	// the short duplicates are under the minimum size from the environment
+	dupes := 0
+	for _, line := range strings.Split(run("--profile=photos"), "\n") {
+		if strings.HasPrefix(line, "Dupe:") {
+			dupes++
+		}
+	}
+	if dupes != 2 {
+		t.Errorf("found %d duplicates with the photos profile, want the 2 long ones", dupes)
+	}
+}
+
+func TestSummary(t *testing.T) {
+	f := newPhotoFixture(t)
+	trash := f.path("trash")
+	if err := os.Mkdir(trash, 0755); err != nil {
+		t.Fatal(err)
+	}
+	got := runDedupe(t, append([]string{"--summary=json", "--trash=" + trash}, f.photoRoots()...)...)
+
+	type breakdown struct {
+		Name           string
+		Files          int64
+		Duplicates     int64
+		DuplicateBytes int64
+		Moved          int64
+		BytesReclaimed int64
+	}
+	var summary struct {
+		FilesScanned    int64
+		BytesScanned    int64
+		DuplicateGroups int64
+		Duplicates      int64
+		DuplicateBytes  int64
+		FilesMoved      int64
+		BytesReclaimed  int64
+		Errors          map[string]int64
+		Stages          []struct{ Name string }
+		ByRoot          []breakdown
+	}
+	if err := json.Unmarshal([]byte(got.stderr), &summary); err != nil {
+		t.Fatalf("failed to parse summary: %v\n%s", err, got.stderr)
+	}
+	// two long and two short files moved
+	duplicateBytes := int64(2*4000 + 2*40)
+	if summary.FilesScanned != 9 || summary.BytesScanned != 4*4000+5*40 {
+		t.Errorf("scanned %d files %d bytes, want 9 files %d bytes", summary.FilesScanned, summary.BytesScanned, 4*4000+5*40)
+	}
+	if summary.DuplicateGroups != 2 || summary.Duplicates != 4 || summary.DuplicateBytes != duplicateBytes {
+		t.Errorf("found %d groups %d duplicates %d bytes, want 2 groups 4 duplicates %d bytes",
+			summary.DuplicateGroups, summary.Duplicates, summary.DuplicateBytes, duplicateBytes)
+	}
+	if summary.FilesMoved != 4 || summary.BytesReclaimed != duplicateBytes {
+		t.Errorf("moved %d files %d bytes, want 4 files %d bytes", summary.FilesMoved, summary.BytesReclaimed, duplicateBytes)
+	}
+	if len(summary.Errors) != 0 {
+		t.Errorf("unexpected errors: %v", summary.Errors)
+	}
+	if len(summary.Stages) != 3 {
+		t.Errorf("stages = %v, want scan, match and move", summary.Stages)
+	}
+	wantRoots := []breakdown{
+		{Name: f.path("photos"), Files: 3},
+		{Name: f.path("backup"), Files: 3, Duplicates: 3, DuplicateBytes: 2*4000 + 40, Moved: 3, BytesReclaimed: 2*4000 + 40},
+		{Name: f.path("unsorted"), Files: 3, Duplicates: 1, DuplicateBytes: 40, Moved: 1, BytesReclaimed: 40},
+	}
+	if !reflect.DeepEqual(summary.ByRoot, wantRoots) {
+		t.Errorf("root breakdown:\n got: %+v\nwant: %+v", summary.ByRoot, wantRoots)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/glxxyz/dedupe/stats"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type HookOptions interface {
+	Trash() string
+	OnDuplicate() string
+	OnMove() string
+	HookTimeout() time.Duration
+	HookConcurrency() int
+}
+
+// hookEvent is what a hook is told about, as JSON on stdin and in $DEDUPE_* variables
+type hookEvent struct {
+	Event      string   `json:"event"`
+	Size       int64    `json:"size"`
+	Hash       string   `json:"hash,omitempty"`
+	Keep       string   `json:"keep"`
+	Duplicates []string `json:"duplicates,omitempty"`
+	File       string   `json:"file,omitempty"`
+	Trash      string   `json:"trash,omitempty"`
+}
+
+func (event *hookEvent) environment() []string {
+	env := []string{
+		"DEDUPE_EVENT=" + event.Event,
+		"DEDUPE_SIZE=" + strconv.FormatInt(event.Size, 10),
+		"DEDUPE_HASH=" + event.Hash,
+		"DEDUPE_KEEP=" + event.Keep,
+	}
+	if event.Duplicates != nil {
+		env = append(env, "DEDUPE_DUPLICATES="+strings.Join(event.Duplicates, "\n"))
+	}
+	if event.File != "" {
+		env = append(env, "DEDUPE_FILE="+event.File, "DEDUPE_TRASH="+event.Trash)
+	}
+	return env
+}
+
+// hooks runs the --on-duplicate and --on-move commands, any that fail veto what they were run for
+type hooks struct {
+	options    HookOptions
+	statistics *stats.Stats
+	running    chan struct{} // a slot for each hook that can run at once
+}
+
+func newHooks(options HookOptions, statistics *stats.Stats) *hooks {
+	return &hooks{options: options, statistics: statistics, running: make(chan struct{}, options.HookConcurrency())}
+}
+
+// duplicate returns false if --on-duplicate vetoes moving any of the group
+func (h *hooks) duplicate(group reportGroup) bool {
+	return h.run("on-duplicate", h.options.OnDuplicate(), &hookEvent{
+		Event:      "duplicate",
+		Size:       group.Size,
+		Hash:       group.Hash,
+		Keep:       group.Keep,
+		Duplicates: group.Duplicates,
+	})
+}
+
+// move returns false if --on-move vetoes moving the file
+func (h *hooks) move(group reportGroup, filePath string) bool {
+	return h.run("on-move", h.options.OnMove(), &hookEvent{
+		Event: "move",
+		Size:  group.Size,
+		Hash:  group.Hash,
+		Keep:  group.Keep,
+		File:  filePath,
+		Trash: h.options.Trash(),
+	})
+}
+
+func (h *hooks) run(name string, command string, event *hookEvent) bool {
+	if command == "" {
+		return true
+	}
+	h.running <- struct{}{}
+	defer func() { <-h.running }()
+	ctx, cancel := context.WithTimeout(context.Background(), h.options.HookTimeout())
+	defer cancel()
+	cmd := shellCommand(ctx, command)
+	input, _ := json.Marshal(event)
+	cmd.Stdin = bytes.NewReader(append(input, '\n'))
+	// stdout is kept for dedupe's own output
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), event.environment()...)
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if ctx.Err() == context.DeadlineExceeded {
+		errLog.Printf("%s timed out after %v: %v\n", name, h.options.HookTimeout(), command)
+		h.statistics.Error(stats.ErrorHook)
+		return false
+	} else if errors.As(err, &exitErr) {
+		return false
+	} else if err != nil {
+		errLog.Printf("error running %s: %v: %v\n", name, command, err)
+		h.statistics.Error(stats.ErrorHook)
+		return false
+	}
+	return true
+}
+
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/C", command)
+	}
+	return exec.CommandContext(ctx, "sh", "-c", command)
+}
+
+// vetoed is printed like a duplicate that apply skips
+func vetoed(filePath string, name string) {
+	fmt.Printf("Skip:\t%v\tvetoed by %s\n", filePath, name)
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/glxxyz/dedupe/param"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// the journal is kept in the trash, it's how restore and purge know what was moved there and where from
+const journalDir = ".dedupe"
+const journalFile = "journal"
+
+// journalLock is held while appending, as the movers all share the journal
+var journalLock sync.Mutex
+
+// runStarted identifies the entries from this run in the journal
+var runStarted = time.Now()
+
+// journalEntry is a line of the journal, for a single file moved to the trash
+type journalEntry struct {
+	Run      time.Time `json:"run"`
+	Time     time.Time `json:"time"`
+	Original string    `json:"original"`
+	Trashed  string    `json:"trashed"`
+	Info     string    `json:"info,omitempty"`   // the .trashinfo file, for the desktop trash
+	Layout   string    `json:"layout,omitempty"` // the --trash-layout it was moved with
+	Digest   string    `json:"sha256,omitempty"` // its contents, for the store
+	Keep     string    `json:"keep"`
+	Size     int64     `json:"size"`
+}
+
+// journalPath is in the home trash for the desktop trash, as that's where it's found by restore and purge
+func journalPath(trash string) (string, error) {
+	if trash == param.TrashXDG {
+		home, err := homeTrash()
+		if err != nil {
+			return "", err
+		}
+		trash = home
+	}
+	return filepath.Join(trash, journalDir, journalFile), nil
+}
+
+func appendJournal(trash string, entry journalEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	journalLock.Lock()
+	defer journalLock.Unlock()
+	path, err := journalPath(trash)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(append(line, '\n'))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// readJournal returns no entries when nothing has been moved to the trash yet
+func readJournal(trash string) ([]journalEntry, error) {
+	path, err := journalPath(trash)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var entries []journalEntry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var entry journalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("journal %q line %d: %w", path, line, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// writeJournal replaces the journal with the entries that are left, removing it once there are none
+func writeJournal(trash string, entries []journalEntry) error {
+	journalLock.Lock()
+	defer journalLock.Unlock()
+	path, err := journalPath(trash)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		os.Remove(filepath.Dir(path))
+		return nil
+	}
+	file, err := ioutil.TempFile(filepath.Dir(path), journalFile+".")
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	for _, entry := range entries {
+		if err = encoder.Encode(entry); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = writer.Flush()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), path)
+	}
+	if err != nil {
+		os.Remove(file.Name())
+	}
+	return err
+}
+
+// removeEmptyParents tidies up the directories in the trash that were only there for the file that's gone
+func removeEmptyParents(trash string, path string) {
+	for dir := filepath.Dir(path); dir != trash && contains(trash, dir); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			return
+		}
+	}
+}
+
+// contains is true if path is dir or inside it
+func contains(dir string, path string) bool {
+	if path == dir {
+		return true
+	}
+	if !strings.HasSuffix(dir, string(filepath.Separator)) {
+		dir += string(filepath.Separator)
+	}
+	return strings.HasPrefix(path, dir)
+}
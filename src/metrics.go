@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"github.com/glxxyz/dedupe/dedupe"
+	"github.com/glxxyz/dedupe/stats"
+	"io"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"sort"
+	"strings"
+)
+
+type MetricsOptions interface {
+	MetricsAddr() string
+	Verbose() bool
+}
+
+// PipelineStatus is read on each scrape, it's satisfied by *dedupe.Scanner
+type PipelineStatus interface {
+	ChannelStatus() []dedupe.ChannelStatus
+	Stats() *stats.Stats
+}
+
+func spawnMetricsServer(options MetricsOptions, pipeline PipelineStatus) {
+	if options.MetricsAddr() == "" {
+		return
+	}
+	listener, err := net.Listen("tcp", options.MetricsAddr())
+	if err != nil {
+		errLog.Printf("failed to listen for metrics on %q: %v\n", options.MetricsAddr(), err)
+		return
+	}
+	if options.Verbose() {
+		fmt.Printf("serving metrics on: %v\n", listener.Addr())
+	}
+	go func() {
+		if err := http.Serve(listener, metricsHandler(pipeline)); err != nil {
+			errLog.Printf("metrics server stopped: %v\n", err)
+		}
+	}()
+}
+
+func metricsHandler(pipeline PipelineStatus) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		writeMetrics(w, pipeline.Stats().Summary(), pipeline.ChannelStatus())
+	})
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return mux
+}
+
+// writeMetrics uses the Prometheus text exposition format
+func writeMetrics(w io.Writer, summary *stats.Summary, channels []dedupe.ChannelStatus) {
+	lengths := make([]string, len(channels))
+	capacities := make([]string, len(channels))
+	sent := make([]string, len(channels))
+	for i, channel := range channels {
+		lengths[i] = labelled("channel", channel.Name, channel.Length)
+		capacities[i] = labelled("channel", channel.Name, channel.Capacity)
+		sent[i] = labelled("channel", channel.Name, channel.Sent)
+	}
+	writeMetric(w, "dedupe_channel_length", "gauge", "Items waiting in each pipeline channel.", lengths...)
+	writeMetric(w, "dedupe_channel_capacity", "gauge", "Buffer size of each pipeline channel.", capacities...)
+	writeMetric(w, "dedupe_channel_sent_total", "counter", "Items sent on each pipeline channel.", sent...)
+	writeMetric(w, "dedupe_files_scanned_total", "counter", "Files found by the scanners.",
+		unlabelled(summary.FilesScanned))
+	writeMetric(w, "dedupe_bytes_scanned_total", "counter", "Total size of the files found by the scanners.",
+		unlabelled(summary.BytesScanned))
+	writeMetric(w, "dedupe_hashes_total", "counter", "Hashes calculated.",
+		labelled("hash", "head", summary.HeadHashes),
+		labelled("hash", "full", summary.FullHashes))
+	writeMetric(w, "dedupe_cached_hashes_total", "counter", "Hashes reused instead of reading the file again.",
+		unlabelled(summary.CachedHashes))
+	samples := make([]string, len(summary.Samples))
+	eliminated := make([]string, len(summary.Samples))
+	var sampledBytes int64
+	for i, sample := range summary.Samples {
+		samples[i] = labelled("stage", sample.Name, sample.Files)
+		eliminated[i] = labelled("stage", sample.Name, sample.Eliminated)
+		sampledBytes += sample.Bytes
+	}
+	writeMetric(w, "dedupe_sample_hashes_total", "counter", "Files hashed by each sampling stage.", samples...)
+	writeMetric(w, "dedupe_sample_eliminated_total", "counter", "Candidates ruled out by each sampling stage.", eliminated...)
+	writeMetric(w, "dedupe_bytes_read_total", "counter", "Bytes read from files.",
+		labelled("reader", "sample", sampledBytes),
+		labelled("reader", "head_hash", summary.HeadHashedBytes),
+		labelled("reader", "full_hash", summary.FullHashedBytes),
+		labelled("reader", "compare", summary.ComparedBytes))
+	writeMetric(w, "dedupe_throttle_seconds_total", "counter", "Time spent waiting for the read limits.",
+		unlabelled(summary.ThrottleSeconds))
+	writeMetric(w, "dedupe_hash_hits_total", "counter", "Lookups that matched an earlier file at each level.",
+		labelled("level", "attributes", summary.AttributeHits),
+		labelled("level", "head_hash", summary.HeadHashHits),
+		labelled("level", "full_hash", summary.FullHashHits))
+	writeMetric(w, "dedupe_duplicate_groups_total", "counter", "Sets of identical files found.",
+		unlabelled(summary.DuplicateGroups))
+	writeMetric(w, "dedupe_duplicates_total", "counter", "Lower priority duplicate files found.",
+		unlabelled(summary.Duplicates))
+	writeMetric(w, "dedupe_duplicate_bytes_total", "counter", "Total size of lower priority duplicate files.",
+		unlabelled(summary.DuplicateBytes))
+	writeMetric(w, "dedupe_files_moved_total", "counter", "Files moved to the trash.",
+		unlabelled(summary.FilesMoved))
+	writeMetric(w, "dedupe_bytes_reclaimed_total", "counter", "Total size of files moved to the trash.",
+		unlabelled(summary.BytesReclaimed))
+
+	kinds := make([]string, 0, len(summary.Errors))
+	for kind := range summary.Errors {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	errors := make([]string, len(kinds))
+	for i, kind := range kinds {
+		errors[i] = labelled("kind", kind, summary.Errors[kind])
+	}
+	writeMetric(w, "dedupe_errors_total", "counter", "Errors by kind.", errors...)
+}
+
+func writeMetric(w io.Writer, name string, kind string, help string, samples ...string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+	for _, sample := range samples {
+		fmt.Fprintf(w, "%s%s\n", name, sample)
+	}
+}
+
+func unlabelled(value interface{}) string {
+	return fmt.Sprintf(" %v", value)
+}
+
+func labelled(label string, value string, sample interface{}) string {
+	return fmt.Sprintf("{%s=\"%s\"} %v", label, labelEscaper.Replace(value), sample)
+}
+
+// labelEscaper escapes a label value as the exposition format does, which is only \, " and newline unlike Go's %q
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
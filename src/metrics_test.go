@@ -0,0 +1,87 @@
+package main
+
+import (
+	"github.com/glxxyz/dedupe/dedupe"
+	"github.com/glxxyz/dedupe/stats"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type fakePipeline struct {
+	channels   []dedupe.ChannelStatus
+	statistics *stats.Stats
+}
+
+func (pipeline *fakePipeline) ChannelStatus() []dedupe.ChannelStatus {
+	return pipeline.channels
+}
+
+func (pipeline *fakePipeline) Stats() *stats.Stats {
+	return pipeline.statistics
+}
+
+func Test_metricsHandler(t *testing.T) {
+	statistics := stats.New([]string{"/photos"})
+	statistics.FileScanned("/photos/a.jpg", 100)
+	statistics.HeadHashed(100)
+	statistics.Error(stats.ErrorOpen)
+	pipeline := &fakePipeline{
+		channels: []dedupe.ChannelStatus{
+			{Name: "scans", Length: 1, Capacity: 5, Sent: 1},
+			{Name: "files", Length: 0, Capacity: 10, Sent: 3},
+			{Name: "groups", Length: 0, Capacity: 15, Sent: 0},
+		},
+		statistics: statistics,
+	}
+
+	server := httptest.NewServer(metricsHandler(pipeline))
+	defer server.Close()
+
+	for path, want := range map[string][]string{
+		"/metrics": {
+			"# TYPE dedupe_channel_length gauge\n",
+			`dedupe_channel_length{channel="scans"} 1` + "\n",
+			`dedupe_channel_capacity{channel="groups"} 15` + "\n",
+			`dedupe_channel_sent_total{channel="files"} 3` + "\n",
+			"dedupe_files_scanned_total 1\n",
+			`dedupe_bytes_read_total{reader="head_hash"} 100` + "\n",
+			`dedupe_errors_total{kind="open"} 1` + "\n",
+		},
+		"/debug/pprof/": {"goroutine"},
+	} {
+		response, err := server.Client().Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := ioutil.ReadAll(response.Body)
+		response.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, line := range want {
+			if !strings.Contains(string(body), line) {
+				t.Errorf("%s doesn't contain %q:\n%s", path, line, body)
+			}
+		}
+	}
+}
+
+func Test_labelled(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"open", `{kind="open"} 1`},
+		{`C:\photos`, `{kind="C:\\photos"} 1`},
+		{`say "cheese"`, `{kind="say \"cheese\""} 1`},
+		{"two\nlines", `{kind="two\nlines"} 1`},
+		{"tab\tand é", "{kind=\"tab\tand é\"} 1"},
+	}
+	for _, tt := range tests {
+		if got := labelled("kind", tt.value, 1); got != tt.want {
+			t.Errorf("labelled(%q) = %s, want %s", tt.value, got, tt.want)
+		}
+	}
+}
@@ -1,32 +1,192 @@
 package main
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"github.com/glxxyz/dedupe/dedupe"
+	"github.com/glxxyz/dedupe/param"
+	"github.com/glxxyz/dedupe/repo"
+	"github.com/glxxyz/dedupe/stats"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 )
 
 type MoveOptions interface {
 	DoMove() bool
 	Trash() string
+	TrashLayout() string
+	Collision() string
 	Verbose() bool
 }
 
-func Move(options MoveOptions, filePath string) {
-	if options.DoMove() {
-		destPath := filepath.Join(options.Trash(), filePath)
+// moveAction reports each duplicate, and moves it to the trash if there is one and the hooks don't veto it
+type moveAction struct {
+	options    MoveOptions
+	reader     repo.ReadOptions
+	statistics *stats.Stats
+	hooks      *hooks
+}
+
+func (action *moveAction) Apply(group dedupe.Group) {
+	keep := group.Keep().Path()
+	for _, file := range group.Duplicates() {
 		fmt.Printf(
-			"Move:\t%v\t%v\n",
-			strings.Replace(filePath, " ", "\\ ", -1),
-			strings.Replace(destPath, " ", "\\ ", -1))
-		folderPath := filepath.Dir(destPath)
-		if err := os.MkdirAll(folderPath, os.ModePerm); err != nil {
-			errLog.Printf("error creating directory: %q: %v\n", folderPath, err)
-		} else if err := os.Rename(filePath, destPath); err != nil {
-			errLog.Printf("error moving file from: %q to: %q: %v\n", filePath, destPath, err)
+			"Dupe:\t%v\t%v\n",
+			strings.Replace(keep, " ", "\\ ", -1),
+			strings.Replace(file.Path(), " ", "\\ ", -1))
+	}
+	report := newReportGroup(group)
+	if !action.hooks.duplicate(report) {
+		for _, file := range group.Duplicates() {
+			vetoed(file.Path(), "on-duplicate")
+		}
+		return
+	}
+	for _, file := range group.Duplicates() {
+		if action.options.DoMove() && !action.hooks.move(report, file.Path()) {
+			vetoed(file.Path(), "on-move")
+			continue
 		}
+		Move(action.options, action.reader, action.statistics, keep, file.Path())
+	}
+}
+
+// Move moves a duplicate of keep to the trash, and records it in the trash journal so it can be restored. The reader is
+// only used by the store, which hashes each file.
+func Move(options MoveOptions, reader repo.ReadOptions, statistics *stats.Stats, keep string, filePath string) {
+	if options.DoMove() && options.Trash() == param.TrashXDG {
+		moveToXDGTrash(statistics, keep, filePath)
+	} else if options.DoMove() && options.TrashLayout() == param.LayoutStore {
+		moveToStore(options, reader, statistics, keep, filePath)
+	} else if options.DoMove() {
+		moveToTrash(options, statistics, keep, filePath)
 	} else {
 		fmt.Printf("Move:\t%v\n", strings.Replace(filePath, " ", "\\ ", -1))
 	}
 }
+
+// trashLock is held from choosing where a file goes in the trash until it's there, so movers can't choose the same
+var trashLock sync.Mutex
+
+func moveToTrash(options MoveOptions, statistics *stats.Stats, keep string, filePath string) {
+	info, err := os.Lstat(filePath)
+	if err != nil {
+		errLog.Printf("error moving file: %q: %v\n", filePath, err)
+		statistics.Error(stats.ErrorMove)
+		return
+	}
+	trashLock.Lock()
+	defer trashLock.Unlock()
+	destPath, ok := resolveCollision(options, statistics, filePath, layoutPath(options, keep, filePath))
+	if !ok {
+		return
+	}
+	// the only taken path it returns is an identical file, which is shared by both entries like the store does
+	shared := inTrash(destPath)
+	fmt.Printf(
+		"Move:\t%v\t%v\n",
+		strings.Replace(filePath, " ", "\\ ", -1),
+		strings.Replace(destPath, " ", "\\ ", -1))
+	folderPath := filepath.Dir(destPath)
+	if shared {
+		if err := os.Remove(filePath); err != nil {
+			errLog.Printf("error removing file: %q: %v\n", filePath, err)
+			statistics.Error(stats.ErrorMove)
+			return
+		}
+	} else if err := os.MkdirAll(folderPath, os.ModePerm); err != nil {
+		errLog.Printf("error creating directory: %q: %v\n", folderPath, err)
+		statistics.Error(stats.ErrorMkdir)
+		return
+	} else if err := os.Rename(filePath, destPath); err != nil {
+		errLog.Printf("error moving file from: %q to: %q: %v\n", filePath, destPath, err)
+		statistics.Error(stats.ErrorMove)
+		return
+	}
+	statistics.Moved(filePath, info.Size())
+	entry := journalEntry{
+		Run:      runStarted,
+		Time:     time.Now(),
+		Original: filePath,
+		Trashed:  destPath,
+		Layout:   options.TrashLayout(),
+		Keep:     keep,
+		Size:     info.Size(),
+	}
+	if err := appendJournal(options.Trash(), entry); err != nil {
+		errLog.Printf("error writing trash journal: %v\n", err)
+		statistics.Error(stats.ErrorJournal)
+	}
+}
+
+// layoutPath is where the trash layout puts a file, before checking whether something's already there
+func layoutPath(options MoveOptions, keep string, filePath string) string {
+	switch options.TrashLayout() {
+	case param.LayoutDated:
+		return filepath.Join(options.Trash(), runStarted.Format("2006-01-02T150405"), filePath)
+	case param.LayoutFlat:
+		return filepath.Join(options.Trash(), pathHash(filePath)+"-"+filepath.Base(filePath))
+	case param.LayoutGroup:
+		return filepath.Join(options.Trash(), pathHash(keep)+"-"+filepath.Base(keep), filepath.Base(filePath))
+	default:
+		return filepath.Join(options.Trash(), filePath)
+	}
+}
+
+// pathHash is short, it only has to tell apart files with the same name
+func pathHash(path string) string {
+	sum := sha256.Sum256([]byte(path))
+	return hex.EncodeToString(sum[:6])
+}
+
+// resolveCollision returns where the file goes when there's already something at destPath, or false if it stays put.
+// For overwrite-if-identical that's destPath itself, which the file then shares rather than replacing.
+func resolveCollision(options MoveOptions, statistics *stats.Stats, filePath string, destPath string) (string, bool) {
+	if !inTrash(destPath) {
+		return destPath, true
+	}
+	switch options.Collision() {
+	case param.CollisionSkip:
+		fmt.Printf("Skip:\t%v\talready in the trash\n", filePath)
+		return "", false
+	case param.CollisionIdentical:
+		same, err := sameContents(filePath, destPath)
+		if err == nil && same {
+			return destPath, true
+		} else if err != nil {
+			errLog.Printf("error comparing files: %v\n", err)
+		}
+		errLog.Printf("not moving: %q as a different file is in the trash at: %q\n", filePath, destPath)
+		statistics.Error(stats.ErrorCollision)
+		return "", false
+	case param.CollisionError:
+		errLog.Printf("not moving: %q as there's already a file in the trash at: %q\n", filePath, destPath)
+		statistics.Error(stats.ErrorCollision)
+		return "", false
+	}
+	return unusedName(destPath, inTrash), true
+}
+
+func inTrash(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+// unusedName numbers a path until it isn't taken
+func unusedName(path string, taken func(string) bool) string {
+	numbered := path
+	for attempt := 2; taken(numbered); attempt++ {
+		numbered = numberedName(path, attempt)
+	}
+	return numbered
+}
+
+// numberedName puts a number before the extension, e.g. photo.2.jpg
+func numberedName(path string, number int) string {
+	extension := filepath.Ext(path)
+	return fmt.Sprintf("%s.%d%s", strings.TrimSuffix(path, extension), number, extension)
+}
@@ -0,0 +1,50 @@
+package param
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var suffixToDuration = map[string]time.Duration{
+	"d": 24 * time.Hour,
+	"w": 7 * 24 * time.Hour,
+}
+
+// dateLayouts are tried in order by parseTime, the ones without a zone are local time
+var dateLayouts = []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02"}
+
+// parseTime takes an age before now, anything parseAge does e.g. 30d, or a date e.g. 2020-01-31 or 2020-01-31T12:00:00
+func parseTime(value string, now time.Time) (time.Time, error) {
+	if age, err := parseAge(value); err == nil {
+		return now.Add(-age), nil
+	}
+	for _, layout := range dateLayouts {
+		if parsed, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return parsed, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("can't parse an age or a date from: %v", value)
+}
+
+// parseAge takes a whole number of days or weeks e.g. 30d, 2w, or anything time.ParseDuration does e.g. 36h
+func parseAge(age string) (time.Duration, error) {
+	for suffix, unit := range suffixToDuration {
+		if count := strings.TrimSuffix(age, suffix); count != age {
+			number, err := strconv.ParseUint(count, 10, 16)
+			if err != nil {
+				return 0, fmt.Errorf("can't parse age: %v", age)
+			}
+			return time.Duration(number) * unit, nil
+		}
+	}
+	duration, err := time.ParseDuration(age)
+	if err != nil {
+		return 0, fmt.Errorf("can't parse age: %v", age)
+	}
+	if duration < 0 {
+		return 0, fmt.Errorf("age can't be negative: %v", age)
+	}
+	return duration, nil
+}
@@ -0,0 +1,72 @@
+package param
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_parseAge(t *testing.T) {
+	successTests := []struct {
+		name string
+		age  string
+		want time.Duration
+	}{
+		{"zero", "0", 0},
+		{"days", "30d", 30 * 24 * time.Hour},
+		{"weeks", "2w", 14 * 24 * time.Hour},
+		{"hours", "36h", 36 * time.Hour},
+	}
+	failureTests := []struct {
+		name string
+		age  string
+	}{
+		{"empty", ""},
+		{"no unit", "30"},
+		{"fraction of days", "1.5d"},
+		{"negative days", "-1d"},
+		{"negative hours", "-1h"},
+		{"text", "month"},
+	}
+	for _, tt := range successTests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := parseAge(tt.age); err != nil {
+				t.Errorf("parseAge() error = %v", err)
+			} else if got != tt.want {
+				t.Errorf("parseAge() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	for _, tt := range failureTests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := parseAge(tt.age); err == nil {
+				t.Errorf("parseAge() got = %v, but want an error", got)
+			}
+		})
+	}
+}
+
+func Test_parseTime(t *testing.T) {
+	now := time.Date(2021, 3, 14, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		value   string
+		want    time.Time
+		wantErr bool
+	}{
+		{"age", "30d", now.Add(-30 * 24 * time.Hour), false},
+		{"date", "2020-01-31", time.Date(2020, 1, 31, 0, 0, 0, 0, time.Local), false},
+		{"local time", "2020-01-31T08:30:00", time.Date(2020, 1, 31, 8, 30, 0, 0, time.Local), false},
+		{"zoned time", "2020-01-31T08:30:00Z", time.Date(2020, 1, 31, 8, 30, 0, 0, time.UTC), false},
+		{"text", "yesterday", time.Time{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTime(tt.value, now)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseTime() error = %v, wantErr %v", err, tt.wantErr)
+			} else if !got.Equal(tt.want) {
+				t.Errorf("parseTime() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,792 @@
+package param
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/glxxyz/dedupe/repo"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// the commands, scan is used when the first argument isn't one of them so that older scripts keep working
+const (
+	CommandScan        = "scan"
+	CommandReport      = "report"
+	CommandVerify      = "verify"
+	CommandApply       = "apply"
+	CommandRestore     = "restore"
+	CommandTrashVerify = "trash verify"
+	CommandPurge       = "trash purge"
+	CommandExtract     = "trash extract"
+	CommandUniques     = "uniques"
+	CommandCompare     = "compare"
+	CommandCatalog     = "catalog create"
+	CommandCatalogDiff = "catalog diff"
+	CommandVersion     = "version"
+)
+
+var usageMessage = `
+Usage: dedupe COMMAND [OPTION]... [ARGUMENT]...
+       dedupe [OPTION]... DIRECTORY...
+
+Search directories for duplicate files, and manage the trash directory they're moved to. Without a COMMAND the
+arguments are passed to scan, so a directory named after a command has to be given as e.g. ./report instead.
+
+Commands:
+        scan                search directories for duplicates and optionally move them to a trash directory
+        report              search directories for duplicates and write a report, without moving anything
+        uniques             list the files in lower priority directories that aren't in a higher priority one
+        compare             compare the contents of two directories, and optionally merge one into the other
+        catalog create      save the path, size and hash of each file in a directory, to diff against later
+        catalog diff        list the files renamed, changed, added or removed between two catalogs or directories
+        verify              check that the duplicates in a report are still identical to the files kept
+        apply               move the duplicates in a report to a trash directory
+        restore             move files in a trash directory back to where they came from
+        trash verify        check that the file kept for each one in a trash directory is still identical
+        trash purge         permanently delete the files in a trash directory that verify
+        trash extract       copy files in a trash directory back to where they came from, leaving them in the trash
+        version             output version and license information
+        help                show the options for a command e.g. dedupe help scan
+
+Options not on the command line are taken from $DEDUPE_<OPTION> e.g. DEDUPE_MIN_SIZE=4M, then from the --profile, then
+from the top of the config file. The config file is $XDG_CONFIG_HOME/dedupe/config.toml, overridden by ./.dedupe.toml
+--older-than means something different to scan and trash purge, so it's set for one command as e.g. scan.older-than
+and DEDUPE_SCAN_OLDER_THAN.
+
+See <https://github.com/glxxyz/dedupe> for documentation and help.
+`
+
+var reportUsage = `
+Usage: dedupe report [OPTION]... DIRECTORY...
+
+Search DIRECTORY(ies)... for duplicate files and write a report of them, nothing is moved. A report written with
+--format=json can be checked with verify and then applied with apply.
+
+Options:
+        --format            how the report is written: text or json, one group of duplicates per line (default: text)
+        --output            file to write the report to (default: stdout)
+
+The options of scan can also be used, apart from --trash.
+
+See <https://github.com/glxxyz/dedupe> for documentation and help.
+`
+
+var uniquesUsage = `
+Usage: dedupe uniques [OPTION]... DIRECTORY...
+
+List the files in each DIRECTORY after the first that have no duplicate in a higher priority DIRECTORY, grouped by the
+directory they're in, and optionally copy or move them somewhere to be organised. Files are matched the same way as
+scan, so the same --compare- options can be used.
+
+Options:
+        --copy-to           directory to copy the unique files to, under their absolute path (default: none)
+        --move-to           directory to move the unique files to, under their absolute path (default: none)
+
+The options of scan can also be used, apart from --trash, the options for moving to the trash, and --scope.
+
+See <https://github.com/glxxyz/dedupe> for documentation and help.
+`
+
+var compareUsage = `
+Usage: dedupe compare [OPTION]... A B
+
+Compare directories A and B by the contents of their files rather than their names, printing the files that are:
+
+        Same:       in both, along with where each is if they're at different paths
+        Changed:    at the same path in both, but with different contents
+        Only in A:  not in B at all, by path or contents
+        Only in B:  not in A at all, by path or contents
+
+Files are matched the same way as scan, so the same --compare- options can be used.
+
+Options:
+        --merge             copy the files that are only in B into A, Changed files are left for you (default: false)
+        --merge-layout      where they go in A: mirror at the same path as in B, by-date in YYYY/MM directories by
+                            modification time, or flat in A itself, numbered if the name's taken (default: mirror)
+
+The options of scan can also be used, apart from --trash, the options for moving to the trash, and --scope.
+
+See <https://github.com/glxxyz/dedupe> for documentation and help.
+`
+
+var verifyUsage = `
+Usage: dedupe verify [OPTION]... REPORT
+
+Check that every duplicate in a JSON REPORT still has the same contents as the file being kept, printing those that
+have changed or gone. Exits with an error if any have.
+
+Options:
+        --verbose           emit verbose information (default: false)
+        --profile           named profile from the config file, also set by $DEDUPE_PROFILE (default: none)
+        --print-config      print the effective options and where each came from, then exit
+
+See <https://github.com/glxxyz/dedupe> for documentation and help.
+`
+
+var applyUsage = `
+Usage: dedupe apply --trash=<trash> [OPTION]... REPORT
+
+Move the duplicates in a JSON REPORT to <trash>. Each one is compared with the file being kept first, and left alone
+if either has changed or gone since the report was written.
+
+Options:
+        --trash             root directory for moved duplicates, or xdg: for the desktop trash
+        --trash-layout      where duplicates go in the trash: mirror, dated, flat, group or store (default: mirror)
+        --on-collision      when the trash already has a file there: suffix, skip, overwrite-if-identical or error
+                            (default: suffix)
+        --on-move           command run by the shell before each duplicate is moved, with the details in $DEDUPE_*
+                            variables and as JSON on stdin, if it fails the duplicate is left where it is
+                            (default: none)
+        --hook-timeout      how long on-move can run before it's stopped and counts as failed (default: 30s)
+        --hook-concurrency  number of on-move commands that can run at once (default: 4)
+        --max-read-rate     limit on bytes read per second when hashing for the store, bytes or human readable e.g. 50M
+                            (default: unlimited)
+        --max-iops          limit on reads per second when hashing for the store (default: unlimited)
+        --background        idle I/O priority, and files are dropped from the page cache once read (default: false)
+        --verbose           emit verbose information (default: false)
+        --profile           named profile from the config file, also set by $DEDUPE_PROFILE (default: none)
+        --print-config      print the effective options and where each came from, then exit
+
+See <https://github.com/glxxyz/dedupe> for documentation and help.
+`
+
+var restoreUsage = `
+Usage: dedupe restore --trash=<trash> [OPTION]... [PATH]...
+
+Move files in <trash> back to where they came from, only those that came from inside PATH(s)... if any are given.
+Files are left in the trash if something else is in their place.
+
+Options:
+        --trash             root directory for moved duplicates, or xdg: for the desktop trash
+        --verbose           emit verbose information (default: false)
+        --profile           named profile from the config file, also set by $DEDUPE_PROFILE (default: none)
+        --print-config      print the effective options and where each came from, then exit
+
+See <https://github.com/glxxyz/dedupe> for documentation and help.
+`
+
+var trashVerifyUsage = `
+Usage: dedupe trash verify --trash=<trash> [OPTION]...
+
+Check each file that was moved to <trash> by hashing it along with the file that was kept instead, printing those
+where the file kept has changed or gone. Exits with an error if any have.
+
+Options:
+        --trash             root directory for moved duplicates, or xdg: for the desktop trash
+        --max-read-rate     limit on bytes read per second, bytes or human readable e.g. 50M (default: unlimited)
+        --max-iops          limit on reads per second (default: unlimited)
+        --background        idle I/O priority, and files are dropped from the page cache once read (default: false)
+        --verbose           emit verbose information (default: false)
+        --profile           named profile from the config file, also set by $DEDUPE_PROFILE (default: none)
+        --print-config      print the effective options and where each came from, then exit
+
+See <https://github.com/glxxyz/dedupe> for documentation and help.
+`
+
+var purgeUsage = `
+Usage: dedupe trash purge --trash=<trash> [OPTION]...
+
+Permanently delete the files that were moved to <trash>, only those that pass trash verify are deleted, then show how
+much space was reclaimed from each run that moved files there.
+
+Options:
+        --trash             root directory for moved duplicates, or xdg: for the desktop trash
+        --older-than        only delete files that have been in the trash this long, e.g. 30d, 2w or 12h (default: 0)
+        --max-read-rate     limit on bytes read per second, bytes or human readable e.g. 50M (default: unlimited)
+        --max-iops          limit on reads per second (default: unlimited)
+        --background        idle I/O priority, and files are dropped from the page cache once read (default: false)
+        --verbose           emit verbose information (default: false)
+        --profile           named profile from the config file, also set by $DEDUPE_PROFILE (default: none)
+        --print-config      print the effective options and where each came from, then exit
+
+See <https://github.com/glxxyz/dedupe> for documentation and help.
+`
+
+var extractUsage = `
+Usage: dedupe trash extract --trash=<trash> [OPTION]... PATH...
+
+Recreate the files that came from inside PATH(s)... by copying them back from <trash>, which is how to get a file out
+of a --trash-layout=store without the other files that share its contents losing them. Files are left in the trash,
+and aren't copied if something else is in their place.
+
+Options:
+        --trash             root directory for moved duplicates, or xdg: for the desktop trash
+        --verbose           emit verbose information (default: false)
+        --profile           named profile from the config file, also set by $DEDUPE_PROFILE (default: none)
+        --print-config      print the effective options and where each came from, then exit
+
+See <https://github.com/glxxyz/dedupe> for documentation and help.
+`
+
+var catalogUsage = `
+Usage: dedupe catalog create [OPTION]... DIRECTORY
+
+Save a catalog of DIRECTORY, a JSON line for each file with its path relative to DIRECTORY, its size, modification
+time and SHA-256 hash, so that it can be compared with how the directory looks later by catalog diff. The files are
+filtered the same way as a scan, so the catalog has the files a scan of DIRECTORY with the same options would find.
+
+Options:
+        --output            file to write the catalog to instead of stdout
+        --min-size          minimum file size, bytes or human readable e.g. 4M, 5G (default: 0)
+        --max-size          maximum file size, bytes or human readable e.g. 4M, 5G (default: unlimited)
+        --ext               only files with these extensions, in any case e.g. jpg,heic,mov (default: all)
+        --exclude-ext       leave out files with these extensions e.g. tmp,part (default: none)
+        --newer-than        only files modified since, an age e.g. 30d, 2w or 12h, or a date e.g. 2020-01-31
+                            (default: any)
+        --older-than        only files modified before, an age or a date the same way (default: any)
+        --type              only files whose contents show they're one of these, whatever their extension:
+                            image, video, audio or document e.g. image,video (default: any)
+        --max-read-rate     limit on bytes read per second, bytes or human readable e.g. 50M (default: unlimited)
+        --max-iops          limit on reads per second (default: unlimited)
+        --background        idle I/O priority, and files are dropped from the page cache once read (default: false)
+        --verbose           emit verbose information (default: false)
+        --profile           named profile from the config file, also set by $DEDUPE_PROFILE (default: none)
+        --print-config      print the effective options and where each came from, then exit
+
+See <https://github.com/glxxyz/dedupe> for documentation and help.
+`
+
+var catalogDiffUsage = `
+Usage: dedupe catalog diff [OPTION]... OLD NEW
+
+Compare two catalogs made by catalog create, matching files by their contents to find where each one went. Either can
+be a directory instead, which is catalogued first with the filters below, a catalog is read as it was created. Prints
+a line for each file that was:
+
+        renamed: OLD PATH -> NEW PATH     moved to a new path with the same contents
+        changed: PATH                     at the same path in both, but with different contents
+        added: PATH                       in NEW only, and not where a file in OLD went
+        removed: PATH                     in OLD only, and not moved anywhere in NEW
+
+Options:
+        --min-size          minimum file size, bytes or human readable e.g. 4M, 5G (default: 0)
+        --max-size          maximum file size, bytes or human readable e.g. 4M, 5G (default: unlimited)
+        --ext               only files with these extensions, in any case e.g. jpg,heic,mov (default: all)
+        --exclude-ext       leave out files with these extensions e.g. tmp,part (default: none)
+        --newer-than        only files modified since, an age e.g. 30d, 2w or 12h, or a date e.g. 2020-01-31
+                            (default: any)
+        --older-than        only files modified before, an age or a date the same way (default: any)
+        --type              only files whose contents show they're one of these, whatever their extension:
+                            image, video, audio or document e.g. image,video (default: any)
+        --max-read-rate     limit on bytes read per second, bytes or human readable e.g. 50M (default: unlimited)
+        --max-iops          limit on reads per second (default: unlimited)
+        --background        idle I/O priority, and files are dropped from the page cache once read (default: false)
+        --verbose           emit verbose information (default: false)
+        --profile           named profile from the config file, also set by $DEDUPE_PROFILE (default: none)
+        --print-config      print the effective options and where each came from, then exit
+
+See <https://github.com/glxxyz/dedupe> for documentation and help.
+`
+
+var versionUsage = `
+Usage: dedupe version
+
+Output version and license information.
+`
+
+type command struct {
+	name  string
+	usage string
+	dirs  bool // the arguments are directories to scan, which can also be set in the config file
+	// define adds the command's options, and returns a function that checks them once they've been parsed
+	define func(flags *flag.FlagSet) func(args []string) (*Options, error)
+}
+
+var commands = []*command{
+	{name: CommandScan, usage: scanUsage, dirs: true, define: func(flags *flag.FlagSet) func([]string) (*Options, error) {
+		return defineScan(flags, CommandScan)
+	}},
+	{name: CommandReport, usage: reportUsage, dirs: true, define: func(flags *flag.FlagSet) func([]string) (*Options, error) {
+		return defineScan(flags, CommandReport)
+	}},
+	{name: CommandUniques, usage: uniquesUsage, dirs: true, define: func(flags *flag.FlagSet) func([]string) (*Options, error) {
+		return defineScan(flags, CommandUniques)
+	}},
+	{name: CommandCompare, usage: compareUsage, define: func(flags *flag.FlagSet) func([]string) (*Options, error) {
+		return defineScan(flags, CommandCompare)
+	}},
+	{name: CommandVerify, usage: verifyUsage, define: defineVerify},
+	{name: CommandApply, usage: applyUsage, define: defineApply},
+	{name: CommandRestore, usage: restoreUsage, define: defineRestore},
+	{name: CommandTrashVerify, usage: trashVerifyUsage, define: defineTrashVerify},
+	{name: CommandPurge, usage: purgeUsage, define: definePurge},
+	{name: CommandExtract, usage: extractUsage, define: defineExtract},
+	{name: CommandCatalog, usage: catalogUsage, define: defineCatalog},
+	{name: CommandCatalogDiff, usage: catalogDiffUsage, define: defineCatalogDiff},
+	{name: CommandVersion, usage: versionUsage, define: defineVersion},
+}
+
+func ParseParameters() (*Options, error) {
+
+	if len(os.Args) < 2 {
+		fmt.Print(usageMessage)
+		os.Exit(0)
+	}
+
+	if os.Args[1] == "help" {
+		return nil, printHelp(os.Args[2:])
+	}
+
+	cmd, args, err := findCommand(os.Args[1:])
+	if err != nil {
+		return nil, err
+	}
+
+	flags := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	check := cmd.define(flags)
+	profile := flags.String("profile", "", "named profile from the config file")
+	printConfigOnly := flags.Bool("print-config", false, "print the effective options and where each came from, then exit")
+
+	if err := flags.Parse(args); err == flag.ErrHelp {
+		fmt.Print(cmd.usage)
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("%v, see: dedupe help %v", err, cmd.name)
+	}
+
+	paths, sources, err := applyConfig(flags, cmd.name, *profile, cmd.dirs)
+	if err != nil {
+		return nil, err
+	}
+
+	if *printConfigOnly {
+		printConfig(os.Stdout, flags, cmd.name, paths, sources)
+		return nil, nil
+	}
+
+	return check(paths)
+}
+
+// commandGroups are the commands that need a second word, with what it can be
+var commandGroups = map[string]string{
+	"trash":   "verify, purge or extract",
+	"catalog": "create or diff",
+}
+
+// findCommand returns scan along with all of the arguments when they don't start with a command
+func findCommand(args []string) (*command, []string, error) {
+	name, rest := args[0], args[1:]
+	group, grouped := commandGroups[name]
+	if grouped {
+		if len(rest) == 0 {
+			return nil, nil, fmt.Errorf("%s needs a command: %s", name, group)
+		}
+		name, rest = name+" "+rest[0], rest[1:]
+	}
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd, rest, nil
+		}
+	}
+	if grouped {
+		return nil, nil, fmt.Errorf("unknown %s command: %v", args[0], args[1])
+	}
+	return commands[0], args, nil
+}
+
+func printHelp(args []string) error {
+	if len(args) == 0 {
+		fmt.Print(usageMessage)
+		return nil
+	}
+	cmd, _, err := findCommand(args)
+	if err != nil {
+		return err
+	}
+	if cmd.name != strings.Join(args, " ") {
+		return fmt.Errorf("unknown command: %v", strings.Join(args, " "))
+	}
+	fmt.Print(cmd.usage)
+	return nil
+}
+
+func defineVerify(flags *flag.FlagSet) func(args []string) (*Options, error) {
+	verbose := flags.Bool("verbose", false, "emit verbose information")
+	return func(args []string) (*Options, error) {
+		report, err := reportArgument(args)
+		if err != nil {
+			return nil, err
+		}
+		return &Options{command: CommandVerify, verbose: *verbose, report: report}, nil
+	}
+}
+
+func defineApply(flags *flag.FlagSet) func(args []string) (*Options, error) {
+	trash := flags.String("trash", "", "directory for 'trashed' files")
+	layout, collision := defineLayout(flags)
+	hooks := defineHooks(flags, false)
+	readLimits := defineReadLimits(flags)
+	verbose := flags.Bool("verbose", false, "emit verbose information")
+	return func(args []string) (*Options, error) {
+		report, err := reportArgument(args)
+		if err != nil {
+			return nil, err
+		}
+		absoluteTrash, err := trashDirectory(*trash)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkLayout(absoluteTrash, *layout, *collision); err != nil {
+			return nil, err
+		}
+		options := &Options{command: CommandApply, trash: absoluteTrash, doMove: true, trashLayout: *layout,
+			collision: *collision, verbose: *verbose, report: report}
+		if err := hooks(options); err != nil {
+			return nil, err
+		}
+		if err := readLimits(options); err != nil {
+			return nil, err
+		}
+		return options, nil
+	}
+}
+
+func defineRestore(flags *flag.FlagSet) func(args []string) (*Options, error) {
+	trash := flags.String("trash", "", "directory for 'trashed' files")
+	verbose := flags.Bool("verbose", false, "emit verbose information")
+	return func(args []string) (*Options, error) {
+		absoluteTrash, err := trashDirectory(*trash)
+		if err != nil {
+			return nil, err
+		}
+		absolutePaths := make([]string, len(args))
+		for i, path := range args {
+			if absolutePaths[i], err = filepath.Abs(path); err != nil {
+				return nil, fmt.Errorf("failed to get an absolute path for %q: %w", path, err)
+			}
+		}
+		return &Options{command: CommandRestore, trash: absoluteTrash, verbose: *verbose, paths: absolutePaths}, nil
+	}
+}
+
+func defineTrashVerify(flags *flag.FlagSet) func(args []string) (*Options, error) {
+	trash := flags.String("trash", "", "directory for 'trashed' files")
+	readLimits := defineReadLimits(flags)
+	verbose := flags.Bool("verbose", false, "emit verbose information")
+	return func(args []string) (*Options, error) {
+		if len(args) > 0 {
+			return nil, fmt.Errorf("trash verify doesn't take any arguments, but found: %v", strings.Join(args, " "))
+		}
+		absoluteTrash, err := trashDirectory(*trash)
+		if err != nil {
+			return nil, err
+		}
+		options := &Options{command: CommandTrashVerify, trash: absoluteTrash, verbose: *verbose}
+		if err := readLimits(options); err != nil {
+			return nil, err
+		}
+		return options, nil
+	}
+}
+
+func definePurge(flags *flag.FlagSet) func(args []string) (*Options, error) {
+	trash := flags.String("trash", "", "directory for 'trashed' files")
+	olderThan := flags.String("older-than", "0", "only delete files that have been in the trash this long, e.g. 30d")
+	readLimits := defineReadLimits(flags)
+	verbose := flags.Bool("verbose", false, "emit verbose information")
+	return func(args []string) (*Options, error) {
+		if len(args) > 0 {
+			return nil, fmt.Errorf("trash purge doesn't take any arguments, but found: %v", strings.Join(args, " "))
+		}
+		absoluteTrash, err := trashDirectory(*trash)
+		if err != nil {
+			return nil, err
+		}
+		age, err := parseAge(*olderThan)
+		if err != nil {
+			return nil, err
+		}
+		options := &Options{command: CommandPurge, trash: absoluteTrash, olderThan: age, verbose: *verbose}
+		if err := readLimits(options); err != nil {
+			return nil, err
+		}
+		return options, nil
+	}
+}
+
+func defineExtract(flags *flag.FlagSet) func(args []string) (*Options, error) {
+	trash := flags.String("trash", "", "directory for 'trashed' files")
+	verbose := flags.Bool("verbose", false, "emit verbose information")
+	return func(args []string) (*Options, error) {
+		if len(args) == 0 {
+			return nil, errors.New("at least one path to extract must be passed in")
+		}
+		absoluteTrash, err := trashDirectory(*trash)
+		if err != nil {
+			return nil, err
+		}
+		absolutePaths := make([]string, len(args))
+		for i, path := range args {
+			if absolutePaths[i], err = filepath.Abs(path); err != nil {
+				return nil, fmt.Errorf("failed to get an absolute path for %q: %w", path, err)
+			}
+		}
+		return &Options{command: CommandExtract, trash: absoluteTrash, verbose: *verbose, paths: absolutePaths}, nil
+	}
+}
+
+func defineCatalog(flags *flag.FlagSet) func(args []string) (*Options, error) {
+	output := flags.String("output", "", "file to write the catalog to instead of stdout")
+	filters := defineFilters(flags)
+	readLimits := defineReadLimits(flags)
+	verbose := flags.Bool("verbose", false, "emit verbose information")
+	return func(args []string) (*Options, error) {
+		if len(args) != 1 {
+			return nil, errors.New("exactly one directory to catalog must be passed in")
+		}
+		if info, err := os.Stat(args[0]); err != nil || !info.IsDir() {
+			return nil, fmt.Errorf("not a directory: %v", args[0])
+		}
+		options := &Options{command: CommandCatalog, output: *output, verbose: *verbose, paths: args}
+		if err := filters(options); err != nil {
+			return nil, err
+		}
+		if err := readLimits(options); err != nil {
+			return nil, err
+		}
+		return options, nil
+	}
+}
+
+func defineCatalogDiff(flags *flag.FlagSet) func(args []string) (*Options, error) {
+	filters := defineFilters(flags)
+	readLimits := defineReadLimits(flags)
+	verbose := flags.Bool("verbose", false, "emit verbose information")
+	return func(args []string) (*Options, error) {
+		if len(args) != 2 {
+			return nil, errors.New("exactly two catalogs or directories must be passed in, the old one then the new")
+		}
+		for _, path := range args {
+			if _, err := os.Stat(path); err != nil {
+				return nil, fmt.Errorf("failed to read catalog: %w", err)
+			}
+		}
+		options := &Options{command: CommandCatalogDiff, verbose: *verbose, paths: args}
+		if err := filters(options); err != nil {
+			return nil, err
+		}
+		if err := readLimits(options); err != nil {
+			return nil, err
+		}
+		return options, nil
+	}
+}
+
+func defineVersion(flags *flag.FlagSet) func(args []string) (*Options, error) {
+	return func(args []string) (*Options, error) {
+		fmt.Print(versionMessage)
+		return nil, nil
+	}
+}
+
+func reportArgument(args []string) (string, error) {
+	if len(args) != 1 {
+		return "", errors.New("exactly one report file must be passed in")
+	}
+	return args[0], nil
+}
+
+// TrashXDG is the --trash for the desktop's trash, following the freedesktop.org trash specification. The colon keeps
+// it apart from a directory called xdg.
+const TrashXDG = "xdg:"
+
+// The --trash-layout is where in the trash each duplicate is moved to
+const (
+	LayoutMirror = "mirror" // its absolute path under the trash
+	LayoutDated  = "dated"  // its absolute path under a directory named for when the run started
+	LayoutFlat   = "flat"   // its name prefixed by a hash of its path, all in the top of the trash
+	LayoutGroup  = "group"  // its name in a directory for each group, named for the file that was kept
+	LayoutStore  = "store"  // ab/cd/<sha256> of its contents, so identical files are only stored once
+)
+
+// The --on-collision policy is what happens when there's already something in the trash where a duplicate would go
+const (
+	CollisionSuffix    = "suffix"                 // number it, e.g. photo.2.jpg
+	CollisionSkip      = "skip"                   // leave it where it is
+	CollisionIdentical = "overwrite-if-identical" // share what's there if it's identical, otherwise it's an error
+	CollisionError     = "error"                  // leave it where it is and count an error
+)
+
+// defineLayout adds the options for where duplicates go in the trash, for the commands that move them
+func defineLayout(flags *flag.FlagSet) (*string, *string) {
+	layout := flags.String("trash-layout", LayoutMirror, "where duplicates go in the trash: mirror, dated, flat, group or store")
+	collision := flags.String("on-collision", CollisionSuffix, "when the trash already has a file there: suffix, skip, overwrite-if-identical or error")
+	return layout, collision
+}
+
+// The --merge-layout is where compare copies the files only in B to in A
+const (
+	MergeMirror = "mirror"  // the same path as in B
+	MergeByDate = "by-date" // YYYY/MM/name by modification time
+	MergeFlat   = "flat"    // the top of A
+)
+
+func checkCompare(paths []string, mergeLayout string) error {
+	if len(paths) != 2 {
+		return fmt.Errorf("exactly two directories must be passed in to compare, but found: %d", len(paths))
+	}
+	if mergeLayout != MergeMirror && mergeLayout != MergeByDate && mergeLayout != MergeFlat {
+		return fmt.Errorf("merge-layout must be one of mirror, by-date or flat, but found: %v", mergeLayout)
+	}
+	a, errA := filepath.Abs(paths[0])
+	b, errB := filepath.Abs(paths[1])
+	if errA == nil && errB == nil && (within(a, b) || within(b, a)) {
+		return fmt.Errorf("can't compare directories when one is inside the other: %v and %v", paths[0], paths[1])
+	}
+	return nil
+}
+
+// within is true if path is dir or inside it
+func within(dir string, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// defineReadLimits adds the options for how fast files are read, for scan and the commands that hash whole directories
+func defineReadLimits(flags *flag.FlagSet) func(options *Options) error {
+	maxReadRate := flags.String("max-read-rate", "0", "limit on bytes read per second, bytes or human readable e.g. 50M")
+	maxIOPS := flags.Int64("max-iops", 0, "limit on reads per second")
+	background := flags.Bool("background", false, "idle I/O priority, and files are dropped from the page cache once read")
+	return func(options *Options) error {
+		readRate, err := parseHumanReadableSize(*maxReadRate)
+		if err != nil {
+			return fmt.Errorf("couldn't parse maximum read rate: %w", err)
+		}
+		if readRate < 0 || *maxIOPS < 0 {
+			return errors.New("max-read-rate and max-iops can't be negative")
+		}
+		options.maxReadRate = readRate
+		options.maxIOPS = *maxIOPS
+		options.background = *background
+		return nil
+	}
+}
+
+// defineFilters adds the options that decide which files are looked at, for the scans and the catalog
+func defineFilters(flags *flag.FlagSet) func(options *Options) error {
+	minSize := flags.String("min-size", "0", "minimum file size, bytes or human readable e.g. 4M, 5G")
+	maxSize := flags.String("max-size", "", "maximum file size, bytes or human readable e.g. 4M, 5G")
+	extensions := flags.String("ext", "", "only files with these extensions e.g. jpg,heic,mov")
+	excludeExtensions := flags.String("exclude-ext", "", "leave out files with these extensions e.g. tmp,part")
+	newerThan := flags.String("newer-than", "", "only files modified since, an age e.g. 30d or a date e.g. 2020-01-31")
+	olderThan := flags.String("older-than", "", "only files modified before, an age e.g. 30d or a date e.g. 2020-01-31")
+	fileTypes := flags.String("type", "", "only files whose contents are one of: image, video, audio or document")
+	return func(options *Options) error {
+		minBytes, err := parseHumanReadableSize(*minSize)
+		if err != nil {
+			return fmt.Errorf("couldn't parse miniumum size: %w", err)
+		}
+
+		var maxBytes int64
+		if *maxSize != "" {
+			if maxBytes, err = parseHumanReadableSize(*maxSize); err != nil {
+				return fmt.Errorf("couldn't parse maximum size: %w", err)
+			}
+			if maxBytes < minBytes {
+				return fmt.Errorf("max-size can't be less than min-size, but found: %v", *maxSize)
+			}
+		}
+
+		var modifiedAfter, modifiedBefore time.Time
+		now := time.Now()
+		if *newerThan != "" {
+			if modifiedAfter, err = parseTime(*newerThan, now); err != nil {
+				return fmt.Errorf("couldn't parse newer-than: %w", err)
+			}
+		}
+		if *olderThan != "" {
+			if modifiedBefore, err = parseTime(*olderThan, now); err != nil {
+				return fmt.Errorf("couldn't parse older-than: %w", err)
+			}
+		}
+		if !modifiedAfter.IsZero() && !modifiedBefore.IsZero() && !modifiedAfter.Before(modifiedBefore) {
+			return errors.New("newer-than must be before older-than, or no files can match")
+		}
+
+		types := parseList(*fileTypes)
+		for _, fileType := range types {
+			switch fileType {
+			case repo.TypeImage, repo.TypeVideo, repo.TypeAudio, repo.TypeDocument:
+			default:
+				return fmt.Errorf("type must be image, video, audio or document, but found: %v", fileType)
+			}
+		}
+
+		options.minBytes = minBytes
+		options.maxBytes = maxBytes
+		options.extensions = parseList(*extensions)
+		options.excludeExtensions = parseList(*excludeExtensions)
+		options.modifiedAfter = modifiedAfter
+		options.modifiedBefore = modifiedBefore
+		options.fileTypes = types
+		return nil
+	}
+}
+
+// defineHooks adds the options for commands run before duplicates are moved, on-duplicate is only for scan which
+// finds the groups
+func defineHooks(flags *flag.FlagSet, scan bool) func(options *Options) error {
+	onDuplicate := new(string)
+	if scan {
+		onDuplicate = flags.String("on-duplicate", "", "command run for each group of duplicates, if it fails none of them are moved")
+	}
+	onMove := flags.String("on-move", "", "command run before each duplicate is moved, if it fails it isn't")
+	timeout := flags.Duration("hook-timeout", 30*time.Second, "how long a hook can run before it's stopped and counts as failed")
+	concurrency := flags.Int("hook-concurrency", 4, "number of hooks that can run at once")
+	return func(options *Options) error {
+		if *timeout <= 0 {
+			return fmt.Errorf("hook-timeout must be more than zero, but found: %v", *timeout)
+		}
+		if *concurrency < 1 {
+			return fmt.Errorf("hook-concurrency must be at least one, but found: %v", *concurrency)
+		}
+		options.onDuplicate = *onDuplicate
+		options.onMove = *onMove
+		options.hookTimeout = *timeout
+		options.hookConcurrency = *concurrency
+		return nil
+	}
+}
+
+func checkLayout(trash string, layout string, collision string) error {
+	switch layout {
+	case LayoutMirror, LayoutDated, LayoutFlat, LayoutGroup, LayoutStore:
+	default:
+		return fmt.Errorf("trash-layout must be one of mirror, dated, flat, group or store, but found: %v", layout)
+	}
+	switch collision {
+	case CollisionSuffix, CollisionSkip, CollisionIdentical, CollisionError:
+	default:
+		return fmt.Errorf("on-collision must be one of suffix, skip, overwrite-if-identical or error, but found: %v", collision)
+	}
+	if trash == TrashXDG && (layout != LayoutMirror || collision != CollisionSuffix) {
+		return errors.New("the desktop trash has its own layout, trash-layout and on-collision can't be used with trash=xdg:")
+	}
+	if layout == LayoutStore && collision != CollisionSuffix {
+		return errors.New("files with the same contents are stored once, on-collision can't be used with trash-layout=store")
+	}
+	return nil
+}
+
+// trashDirectory returns the absolute path of an existing trash directory, or TrashXDG
+func trashDirectory(trash string) (string, error) {
+	if trash == "" {
+		return "", errors.New("trash must be set")
+	}
+	if trash == TrashXDG {
+		return trash, nil
+	}
+	absolute, err := filepath.Abs(trash)
+	if err != nil {
+		return "", fmt.Errorf("failed to get an absolute path for %q: %w", trash, err)
+	}
+	if _, err := os.Stat(absolute); os.IsNotExist(err) {
+		return "", fmt.Errorf("trash path does not exist: %s", trash)
+	}
+	return absolute, nil
+}
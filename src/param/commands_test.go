@@ -0,0 +1,90 @@
+package param
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func Test_findCommand(t *testing.T) {
+	successTests := []struct {
+		name    string
+		args    []string
+		command string
+		rest    []string
+	}{
+		{"scan", []string{"scan", "--verbose", "/photos"}, CommandScan, []string{"--verbose", "/photos"}},
+		{"no command", []string{"--trash=/trash", "/photos"}, CommandScan, []string{"--trash=/trash", "/photos"}},
+		{"directory", []string{"photos"}, CommandScan, []string{"photos"}},
+		{"report", []string{"report", "/photos"}, CommandReport, []string{"/photos"}},
+		{"trash purge", []string{"trash", "purge", "--trash=/trash"}, CommandPurge, []string{"--trash=/trash"}},
+		{"catalog diff", []string{"catalog", "diff", "old.json", "/photos"}, CommandCatalogDiff, []string{"old.json", "/photos"}},
+	}
+	failureTests := []struct {
+		name string
+		args []string
+	}{
+		{"trash on its own", []string{"trash"}},
+		{"unknown trash command", []string{"trash", "empty"}},
+		{"catalog on its own", []string{"catalog"}},
+	}
+	for _, tt := range successTests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, rest, err := findCommand(tt.args)
+			if err != nil {
+				t.Errorf("findCommand() error = %v", err)
+			} else if cmd.name != tt.command || !reflect.DeepEqual(rest, tt.rest) {
+				t.Errorf("findCommand() got = %v %q, want %v %q", cmd.name, rest, tt.command, tt.rest)
+			}
+		})
+	}
+	for _, tt := range failureTests {
+		t.Run(tt.name, func(t *testing.T) {
+			if cmd, _, err := findCommand(tt.args); err == nil {
+				t.Errorf("findCommand() got = %v, but want an error", cmd.name)
+			}
+		})
+	}
+}
+
+func Test_trashDirectory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dedupe-trash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Mkdir(filepath.Join(dir, "xdg"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	// the path as the test sees it, after any symbolic links in the temporary directory
+	xdgDir, err := filepath.Abs("xdg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		trash string
+		want  string
+	}{
+		{"xdg:", TrashXDG},
+		{"xdg", xdgDir},
+		{"./xdg", xdgDir},
+	}
+	for _, tt := range tests {
+		if got, err := trashDirectory(tt.trash); err != nil || got != tt.want {
+			t.Errorf("trashDirectory(%q) = %q, %v, want %q", tt.trash, got, err, tt.want)
+		}
+	}
+	if _, err := trashDirectory("missing"); err == nil {
+		t.Errorf("trashDirectory(%q) should fail", "missing")
+	}
+}
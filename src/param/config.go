@@ -0,0 +1,381 @@
+package param
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// where each option came from, in order of precedence
+const (
+	sourceCommandLine = "command line"
+	sourceEnvironment = "environment"
+	sourceDefault     = "default"
+)
+
+// these only make sense on the command line
+var notConfigurable = map[string]bool{
+	"version":      true,
+	"print-config": true,
+	"profile":      true,
+}
+
+// commandScoped options mean something different to each command that has them, e.g. --older-than is how long a file
+// has been in the trash for trash purge but when it was modified for a scan, so they're set for one command at a time
+var commandScoped = map[string]bool{
+	"older-than": true,
+}
+
+// configKey is what an option is called in the config files, and by way of envName in the environment. It's the
+// option's name, or <command>.<option> e.g. trash-purge.older-than for the options that are scoped to a command.
+func configKey(command string, option string) string {
+	if commandScoped[option] {
+		return strings.Replace(command, " ", "-", -1) + "." + option
+	}
+	return option
+}
+
+type configValue struct {
+	value  string   // as it would be passed on the command line
+	list   []string // only used for paths
+	source string
+}
+
+// config holds the settings from the config files, top level keys apply to every run and [profiles.<name>] tables
+// override them when that profile is chosen
+type config struct {
+	base     map[string]configValue
+	profiles map[string]map[string]configValue
+}
+
+func newConfig() *config {
+	return &config{base: make(map[string]configValue), profiles: make(map[string]map[string]configValue)}
+}
+
+// configFiles are read in order, so settings in the current directory override the user's
+func configFiles() []string {
+	var files []string
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			dir = filepath.Join(home, ".config")
+		}
+	}
+	if dir != "" {
+		files = append(files, filepath.Join(dir, "dedupe", "config.toml"))
+	}
+	return append(files, ".dedupe.toml")
+}
+
+func loadConfig() (*config, error) {
+	merged := newConfig()
+	for _, path := range configFiles() {
+		file, err := os.Open(path)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to open config file: %w", err)
+		}
+		parsed, err := parseConfig(file, path)
+		file.Close()
+		if err != nil {
+			return nil, err
+		}
+		merged.merge(parsed)
+	}
+	return merged, nil
+}
+
+func (c *config) merge(other *config) {
+	for key, value := range other.base {
+		c.base[key] = value
+	}
+	for name, profile := range other.profiles {
+		if _, ok := c.profiles[name]; !ok {
+			c.profiles[name] = make(map[string]configValue)
+		}
+		for key, value := range profile {
+			c.profiles[name][key] = value
+		}
+	}
+}
+
+// settings combines the top level settings with the chosen profile, if there is one
+func (c *config) settings(profile string) (map[string]configValue, error) {
+	settings := make(map[string]configValue)
+	for key, value := range c.base {
+		settings[key] = value
+	}
+	if profile != "" {
+		values, ok := c.profiles[profile]
+		if !ok {
+			return nil, fmt.Errorf("profile %q isn't in any config file: %v", profile, strings.Join(configFiles(), ", "))
+		}
+		for key, value := range values {
+			settings[key] = value
+		}
+	}
+	for key, value := range settings {
+		if key == "paths" {
+			if value.list == nil {
+				return nil, fmt.Errorf("paths must be a list of directories in %s", value.source)
+			}
+		} else if commandScoped[key] {
+			return nil, fmt.Errorf("option %q has to be set for each command e.g. scan.%s in %s", key, key, value.source)
+		} else if !configurable(key) {
+			return nil, fmt.Errorf("unknown option %q in %s", key, value.source)
+		} else if value.list != nil {
+			return nil, fmt.Errorf("option %q can't be a list in %s", key, value.source)
+		}
+	}
+	return settings, nil
+}
+
+// applyConfig sets each flag that wasn't on the command line from the environment or the config files, and returns
+// the paths to scan along with where each option came from
+func applyConfig(flags *flag.FlagSet, command string, profile string, dirs bool) ([]string, map[string]string, error) {
+	commandLine := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) {
+		commandLine[f.Name] = true
+	})
+	if env, ok := os.LookupEnv(envName("profile")); ok && !commandLine["profile"] {
+		profile = env
+	}
+	loaded, err := loadConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+	settings, err := loaded.settings(profile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sources := make(map[string]string)
+	var setErr error
+	flags.VisitAll(func(f *flag.Flag) {
+		if setErr != nil {
+			return
+		}
+		key := configKey(command, f.Name)
+		env, inEnv := os.LookupEnv(envName(key))
+		setting, inConfig := settings[key]
+		switch {
+		case commandLine[f.Name]:
+			sources[f.Name] = sourceCommandLine
+		case notConfigurable[f.Name]:
+			sources[f.Name] = sourceDefault
+		case inEnv:
+			if err := flags.Set(f.Name, env); err != nil {
+				setErr = fmt.Errorf("invalid value %q for %s: %w", env, envName(key), err)
+			}
+			sources[f.Name] = sourceEnvironment
+		case inConfig:
+			if err := flags.Set(f.Name, setting.value); err != nil {
+				setErr = fmt.Errorf("invalid value %q for %s in %s: %w", setting.value, key, setting.source, err)
+			}
+			sources[f.Name] = setting.source
+		default:
+			sources[f.Name] = sourceDefault
+		}
+	})
+	if setErr != nil {
+		return nil, nil, setErr
+	}
+
+	paths := flags.Args()
+	sources["paths"] = sourceCommandLine
+	if len(paths) == 0 && dirs {
+		if env, ok := os.LookupEnv(envName("paths")); ok {
+			paths = filepath.SplitList(env)
+			sources["paths"] = sourceEnvironment
+		} else if setting, ok := settings["paths"]; ok {
+			paths = setting.list
+			sources["paths"] = setting.source
+		}
+	}
+	return paths, sources, nil
+}
+
+// configurable is true for options of any command, as the top of the config file applies to them all
+func configurable(key string) bool {
+	if notConfigurable[key] {
+		return false
+	}
+	for _, cmd := range commands {
+		flags := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+		cmd.define(flags)
+		found := false
+		flags.VisitAll(func(f *flag.Flag) {
+			found = found || configKey(cmd.name, f.Name) == key
+		})
+		if found {
+			return true
+		}
+	}
+	return false
+}
+
+// envName is e.g. DEDUPE_MIN_SIZE for --min-size, or DEDUPE_TRASH_PURGE_OLDER_THAN for trash-purge.older-than
+func envName(key string) string {
+	return "DEDUPE_" + strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(key))
+}
+
+// printConfig writes the effective options in the config file format, so they can be copied into one
+func printConfig(w io.Writer, flags *flag.FlagSet, command string, paths []string, sources map[string]string) {
+	fmt.Fprintf(w, "# effective options, from the %s, %s, config files, or %s\n",
+		sourceCommandLine, sourceEnvironment, sourceDefault)
+	flags.VisitAll(func(f *flag.Flag) {
+		if notConfigurable[f.Name] {
+			return
+		}
+		fmt.Fprintf(w, "%s = %s  # %s\n", configKey(command, f.Name), configString(f), sources[f.Name])
+	})
+	quoted := make([]string, len(paths))
+	for i, path := range paths {
+		quoted[i] = strconv.Quote(path)
+	}
+	fmt.Fprintf(w, "paths = [%s]  # %s\n", strings.Join(quoted, ", "), sources["paths"])
+}
+
+func configString(f *flag.Flag) string {
+	if getter, ok := f.Value.(flag.Getter); ok {
+		switch value := getter.Get().(type) {
+		case bool, int, int64:
+			return fmt.Sprint(value)
+		}
+	}
+	return strconv.Quote(f.Value.String())
+}
+
+// parseConfig reads the subset of TOML that's needed: comments, [profiles.<name>] tables, and keys set to strings,
+// booleans, numbers, or lists of strings
+func parseConfig(r io.Reader, path string) (*config, error) {
+	parsed := newConfig()
+	table := parsed.base
+	source := "config file " + path
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(stripComment(scanner.Text()))
+		if text == "" {
+			continue
+		}
+		if strings.HasPrefix(text, "[") {
+			name := strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(text, "["), "]"))
+			profile := strings.TrimPrefix(name, "profiles.")
+			if !strings.HasSuffix(text, "]") || profile == name || profile == "" {
+				return nil, fmt.Errorf("%s:%d: tables must be [profiles.<name>], but found: %v", path, line, text)
+			}
+			if _, ok := parsed.profiles[profile]; ok {
+				return nil, fmt.Errorf("%s:%d: profile %q is defined twice", path, line, profile)
+			}
+			table = make(map[string]configValue)
+			parsed.profiles[profile] = table
+			source = fmt.Sprintf("profile %s in %s", profile, path)
+			continue
+		}
+		parts := strings.SplitN(text, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected key = value, but found: %v", path, line, text)
+		}
+		key := strings.TrimSpace(parts[0])
+		if _, ok := table[key]; ok {
+			return nil, fmt.Errorf("%s:%d: %q is set twice", path, line, key)
+		}
+		value, err := parseConfigValue(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		value.source = source
+		table[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read config file %s: %w", path, err)
+	}
+	return parsed, nil
+}
+
+func parseConfigValue(text string) (configValue, error) {
+	if strings.HasPrefix(text, "[") && strings.HasSuffix(text, "]") {
+		list := []string{}
+		for _, item := range splitList(text[1 : len(text)-1]) {
+			value, err := parseConfigValue(item)
+			if err != nil || value.list != nil || !isQuoted(item) {
+				return configValue{}, fmt.Errorf("lists can only hold strings, but found: %v", item)
+			}
+			list = append(list, value.value)
+		}
+		return configValue{list: list}, nil
+	}
+	if strings.HasPrefix(text, "'") && strings.HasSuffix(text, "'") && len(text) > 1 {
+		return configValue{value: text[1 : len(text)-1]}, nil
+	}
+	if strings.HasPrefix(text, `"`) {
+		value, err := strconv.Unquote(text)
+		if err != nil {
+			return configValue{}, fmt.Errorf("invalid string: %v", text)
+		}
+		return configValue{value: value}, nil
+	}
+	if text == "" || strings.ContainsAny(text, " \t\"'") {
+		return configValue{}, fmt.Errorf("expected a string, boolean, number, or list, but found: %v", text)
+	}
+	return configValue{value: text}, nil
+}
+
+func isQuoted(text string) bool {
+	return strings.HasPrefix(text, `"`) || strings.HasPrefix(text, "'")
+}
+
+// splitList splits on the commas that aren't inside strings, allowing a trailing comma
+func splitList(text string) []string {
+	var items []string
+	var quote rune
+	start := 0
+	for i, r := range text {
+		switch {
+		case quote != 0 && r == '\\' && quote == '"':
+			// the escaped character can't end the string, it's skipped below
+		case quote != 0 && r == quote && !escaped(text, i):
+			quote = 0
+		case quote == 0 && (r == '"' || r == '\''):
+			quote = r
+		case quote == 0 && r == ',':
+			items = append(items, strings.TrimSpace(text[start:i]))
+			start = i + 1
+		}
+	}
+	if last := strings.TrimSpace(text[start:]); last != "" {
+		items = append(items, last)
+	}
+	return items
+}
+
+// stripComment removes anything after a # that isn't inside a string
+func stripComment(line string) string {
+	var quote rune
+	for i, r := range line {
+		switch {
+		case quote != 0 && r == quote && !(quote == '"' && escaped(line, i)):
+			quote = 0
+		case quote == 0 && (r == '"' || r == '\''):
+			quote = r
+		case quote == 0 && r == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// escaped is true if the character at i follows an odd number of backslashes
+func escaped(text string, i int) bool {
+	count := 0
+	for i--; i >= 0 && text[i] == '\\'; i-- {
+		count++
+	}
+	return count%2 == 1
+}
@@ -0,0 +1,112 @@
+package param
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_parseConfig(t *testing.T) {
+	successTests := []struct {
+		name     string
+		text     string
+		base     map[string]string
+		profiles map[string]map[string]string
+	}{
+		{"empty", "# nothing here\n\n", map[string]string{}, nil},
+		{"values", "min-size = \"4K\" # comment\nverbose=true\nscanners = 3\ntrash = 'C:\\trash'\n",
+			map[string]string{"min-size": "4K", "verbose": "true", "scanners": "3", "trash": `C:\trash`}, nil},
+		{"hash in string", `trash = "/tmp/#trash" # comment`, map[string]string{"trash": "/tmp/#trash"}, nil},
+		{"profiles", "verbose = true\n[profiles.photos]\ncompare-contents = true\n[ profiles.music ]\nmin-size = \"1M\"\n",
+			map[string]string{"verbose": "true"},
+			map[string]map[string]string{"photos": {"compare-contents": "true"}, "music": {"min-size": "1M"}}},
+	}
+	failureTests := []struct {
+		name string
+		text string
+	}{
+		{"no value", "verbose\n"},
+		{"unknown table", "[photos]\n"},
+		{"unclosed table", "[profiles.photos\n"},
+		{"set twice", "verbose = true\nverbose = false\n"},
+		{"profile twice", "[profiles.a]\n[profiles.a]\n"},
+		{"unclosed string", `trash = "/tmp`},
+		{"bare words", "trash = /tmp/my trash\n"},
+		{"list of numbers", "paths = [1, 2]\n"},
+	}
+	for _, tt := range successTests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, err := parseConfig(strings.NewReader(tt.text), "test.toml")
+			if err != nil {
+				t.Fatalf("parseConfig() error = %v", err)
+			}
+			if got := configValues(parsed.base); !reflect.DeepEqual(got, tt.base) {
+				t.Errorf("parseConfig() got = %v, want %v", got, tt.base)
+			}
+			for name, want := range tt.profiles {
+				if got := configValues(parsed.profiles[name]); !reflect.DeepEqual(got, want) {
+					t.Errorf("parseConfig() profile %v got = %v, want %v", name, got, want)
+				}
+			}
+			if len(parsed.profiles) != len(tt.profiles) {
+				t.Errorf("parseConfig() got %d profiles, want %d", len(parsed.profiles), len(tt.profiles))
+			}
+		})
+	}
+	for _, tt := range failureTests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := parseConfig(strings.NewReader(tt.text), "test.toml"); err == nil {
+				t.Errorf("parseConfig() got = %v, but want an error", got)
+			}
+		})
+	}
+}
+
+func Test_parseConfigValue(t *testing.T) {
+	got, err := parseConfigValue(`["/photos", '/backup, old', "/tmp/\"quoted\"",]`)
+	if err != nil {
+		t.Fatalf("parseConfigValue() error = %v", err)
+	}
+	want := []string{"/photos", "/backup, old", `/tmp/"quoted"`}
+	if !reflect.DeepEqual(got.list, want) {
+		t.Errorf("parseConfigValue() got = %q, want %q", got.list, want)
+	}
+}
+
+func Test_configKey(t *testing.T) {
+	tests := []struct {
+		command string
+		option  string
+		key     string
+		env     string
+	}{
+		{CommandScan, "min-size", "min-size", "DEDUPE_MIN_SIZE"},
+		{CommandScan, "older-than", "scan.older-than", "DEDUPE_SCAN_OLDER_THAN"},
+		{CommandPurge, "older-than", "trash-purge.older-than", "DEDUPE_TRASH_PURGE_OLDER_THAN"},
+	}
+	for _, tt := range tests {
+		if got := configKey(tt.command, tt.option); got != tt.key || envName(got) != tt.env {
+			t.Errorf("configKey(%q, %q) = %q and %q, want %q and %q", tt.command, tt.option, got, envName(got), tt.key, tt.env)
+		}
+	}
+	for key, want := range map[string]bool{"scan.older-than": true, "trash-purge.older-than": true, "older-than": false, "trash-purge.min-size": false} {
+		if got := configurable(key); got != want {
+			t.Errorf("configurable(%q) = %v, want %v", key, got, want)
+		}
+	}
+	parsed, err := parseConfig(strings.NewReader("older-than = \"30d\"\n"), "test.toml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parsed.settings(""); err == nil {
+		t.Error("settings() accepted older-than without a command")
+	}
+}
+
+func configValues(table map[string]configValue) map[string]string {
+	values := make(map[string]string)
+	for key, value := range table {
+		values[key] = value.value
+	}
+	return values
+}
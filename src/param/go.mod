@@ -1,3 +1,10 @@
 module github.com/glxxyz/dedupe/param
 
 go 1.14
+
+replace (
+	github.com/glxxyz/dedupe/repo v0.0.0 => ../repo
+	github.com/glxxyz/dedupe/stats v0.0.0 => ../stats
+)
+
+require github.com/glxxyz/dedupe/repo v0.0.0
@@ -1,27 +1,72 @@
 package param
 
+import (
+	"github.com/glxxyz/dedupe/repo"
+	"time"
+)
+
 type Options struct {
-	trash       string
-	doMove      bool
-	modTime     bool
-	name        bool
-	size        bool
-	hash        bool
-	contents    bool
-	minBytes    int64
-	symLinks    bool
-	verbose     bool
-	scanBuffer  int
-	scanners    int
-	matchBuffer int
-	matchers    int
-	moveBuffer  int
-	movers      int
-	paths       []string
+	command           string
+	trash             string
+	doMove            bool
+	trashLayout       string
+	collision         string
+	emitScript        string
+	onDuplicate       string
+	onMove            string
+	hookTimeout       time.Duration
+	hookConcurrency   int
+	modTime           bool
+	name              bool
+	size              bool
+	hash              bool
+	contents          bool
+	samples           []repo.Sample
+	minBytes          int64
+	symLinks          bool
+	maxBytes          int64
+	extensions        []string
+	excludeExtensions []string
+	modifiedAfter     time.Time
+	modifiedBefore    time.Time
+	fileTypes         []string
+	scope             string
+	verbose           bool
+	scanBuffer        int
+	scanners          int
+	matchBuffer       int
+	matchers          int
+	moveBuffer        int
+	movers            int
+	hddReaders        int
+	maxReadRate       int64
+	maxIOPS           int64
+	background        bool
+	ssdReaders        int
+	external          bool
+	spillRecords      int
+	stateDir          string
+	resume            bool
+	summary           string
+	progress          bool
+	metricsAddr       string
+	paths             []string
+	format            string
+	output            string
+	uniquesTo         string
+	uniquesMove       bool
+	merge             bool
+	mergeLayout       string
+	report            string
+	olderThan         time.Duration
 }
 
 // dumb accessors that allow for encapsulation
 
+func (options *Options) Command() string {
+	return options.command
+}
+
 func (options *Options) Trash() string {
 	return options.trash
 }
@@ -50,10 +95,45 @@ func (options *Options) Contents() bool {
 	return options.contents
 }
 
+func (options *Options) Samples() []repo.Sample {
+	return options.samples
+}
+
 func (options *Options) MinBytes() int64 {
 	return options.minBytes
 }
 
+// MaxBytes is zero when there's no maximum
+func (options *Options) MaxBytes() int64 {
+	return options.maxBytes
+}
+
+func (options *Options) Extensions() []string {
+	return options.extensions
+}
+
+func (options *Options) ExcludeExtensions() []string {
+	return options.excludeExtensions
+}
+
+// ModifiedAfter is zero when --newer-than isn't set
+func (options *Options) ModifiedAfter() time.Time {
+	return options.modifiedAfter
+}
+
+// ModifiedBefore is zero when --older-than isn't set
+func (options *Options) ModifiedBefore() time.Time {
+	return options.modifiedBefore
+}
+
+func (options *Options) FileTypes() []string {
+	return options.fileTypes
+}
+
+func (options *Options) Scope() string {
+	return options.scope
+}
+
 func (options *Options) SymLinks() bool {
 	return options.symLinks
 }
@@ -86,6 +166,114 @@ func (options *Options) Movers() int {
 	return options.movers
 }
 
+func (options *Options) HDDReaders() int {
+	return options.hddReaders
+}
+
+func (options *Options) SSDReaders() int {
+	return options.ssdReaders
+}
+
+func (options *Options) MaxReadRate() int64 {
+	return options.maxReadRate
+}
+
+func (options *Options) MaxIOPS() int64 {
+	return options.maxIOPS
+}
+
+func (options *Options) Background() bool {
+	return options.background
+}
+
+func (options *Options) External() bool {
+	return options.external
+}
+
+func (options *Options) SpillRecords() int {
+	return options.spillRecords
+}
+
+func (options *Options) StateDir() string {
+	return options.stateDir
+}
+
+func (options *Options) Resume() bool {
+	return options.resume
+}
+
+func (options *Options) Summary() string {
+	return options.summary
+}
+
+func (options *Options) Progress() bool {
+	return options.progress
+}
+
+func (options *Options) MetricsAddr() string {
+	return options.metricsAddr
+}
+
 func (options *Options) Paths() []string {
 	return options.paths
 }
+
+func (options *Options) Format() string {
+	return options.format
+}
+
+func (options *Options) Output() string {
+	return options.output
+}
+
+func (options *Options) UniquesTo() string {
+	return options.uniquesTo
+}
+
+func (options *Options) UniquesMove() bool {
+	return options.uniquesMove
+}
+
+func (options *Options) Merge() bool {
+	return options.merge
+}
+
+func (options *Options) MergeLayout() string {
+	return options.mergeLayout
+}
+
+func (options *Options) Report() string {
+	return options.report
+}
+
+func (options *Options) OlderThan() time.Duration {
+	return options.olderThan
+}
+
+func (options *Options) TrashLayout() string {
+	return options.trashLayout
+}
+
+func (options *Options) Collision() string {
+	return options.collision
+}
+
+func (options *Options) EmitScript() string {
+	return options.emitScript
+}
+
+func (options *Options) OnDuplicate() string {
+	return options.onDuplicate
+}
+
+func (options *Options) OnMove() string {
+	return options.onMove
+}
+
+func (options *Options) HookTimeout() time.Duration {
+	return options.hookTimeout
+}
+
+func (options *Options) HookConcurrency() int {
+	return options.hookConcurrency
+}
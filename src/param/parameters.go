@@ -4,10 +4,12 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"github.com/glxxyz/dedupe/repo"
 	"log"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
 )
 
 var errLog = log.New(os.Stderr, "", 0)
@@ -19,9 +21,9 @@ Distributed under the MIT license <https://opensource.org/licenses/MIT>.
 See <https://github.com/glxxyz/dedupe> for documentation and help.
 `
 
-var usageMessage = `
-Usage: dedupe [OPTION] DIRECTORY...
-       dedupe --trash=<trash> [OPTION]... DIRECTORY...
+var scanUsage = `
+Usage: dedupe [scan] [OPTION]... DIRECTORY...
+       dedupe [scan] --trash=<trash> [OPTION]... DIRECTORY...
 
 Search DIRECTORY(ies)... for duplicate files and optionally moves them to <trash> without user interaction.
 
@@ -30,7 +32,25 @@ DIRECTORY order is used for priority, highest first. Higher priority files are l
 Mandatory parameters:
 
 Options:
-        --trash             root directory for moved duplicates, (default: files not moved)
+        --trash             root directory for moved duplicates, or xdg: to use the desktop trash of each file's volume
+                            so they can be restored from the file manager (default: files not moved)
+        --trash-layout      where duplicates go in the trash: mirror keeps their absolute path, dated puts that
+                            under a directory for the run, flat names them by a hash of their path, group puts them
+                            in a directory for each group, and store keeps one copy of each content as ab/cd/<sha256>
+                            (default: mirror)
+        --on-collision      when the trash already has a file there: suffix numbers the new one, skip leaves it,
+                            overwrite-if-identical shares an identical file, error leaves it and counts an error
+                            (default: suffix)
+        --emit-script       write a sh or ps1 script to stdout that moves the duplicates to <trash>, so it can be
+                            checked before it's run, nothing is moved by dedupe itself, on-collision can only be
+                            suffix or skip (default: none)
+        --on-duplicate      command run by the shell for each group of duplicates found, with the details in $DEDUPE_*
+                            variables and as JSON on stdin, if it fails none of the group are moved (default: none)
+        --on-move           command run the same way before each duplicate is moved to <trash>, if it fails the
+                            duplicate is left where it is (default: none)
+        --hook-timeout      how long on-duplicate and on-move can run before they're stopped and count as failed
+                            (default: 30s)
+        --hook-concurrency  number of on-duplicate and on-move commands that can run at once (default: 4)
         --compare-time      compare file modification time (default: false)
         --compare-name      compare file name (default: false)
         --compare-size      compare file size (default: true)
@@ -38,7 +58,29 @@ Options:
         --compare-contents  compare whole file contents (default: false)
         --min-size          minimum file size, bytes or human readable e.g. 4M, 5G (default 1)
         --follow-symlinks   follow symbolic links, false ignores them (default false)
+        --max-size          maximum file size, bytes or human readable e.g. 4M, 5G (default: unlimited)
+        --ext               only files with these extensions, in any case e.g. jpg,heic,mov (default: all)
+        --exclude-ext       leave out files with these extensions e.g. tmp,part (default: none)
+        --newer-than        only files modified since, an age e.g. 30d, 2w or 12h, or a date e.g. 2020-01-31
+                            (default: any)
+        --older-than        only files modified before, an age or a date the same way (default: any)
+        --type              only files whose contents show they're one of these, whatever their extension:
+                            image, video, audio or document e.g. image,video (default: any)
+        --scope             which duplicates are acted on: cross-root only those in a different DIRECTORY to the
+                            file kept, within-root only those in the same DIRECTORY as another, or all (default: all)
+        --max-read-rate     limit on bytes read per second, bytes or human readable e.g. 50M (default: unlimited)
+        --max-iops          limit on reads per second (default: unlimited)
+        --background        idle I/O priority, and files are dropped from the page cache once read (default: false)
+        --external          bounded memory for huge scans, files are spilled to $TMPDIR and matched a size at a time
+                            (default: false)
+        --state-dir         save checkpoints of the directories walked and hashes calculated here (default: none)
+        --resume            continue from the last checkpoint in --state-dir, rehashing files that changed
+                            (default: false)
+        --progress          show progress on stderr when it's a terminal (default: true)
+        --summary           end of run summary to stderr: text, json or none (default: text)
         --verbose           emit verbose information (default: false)
+        --profile           named profile from the config file, also set by $DEDUPE_PROFILE (default: none)
+        --print-config      print the effective options and where each came from, then exit
         --version           output version and license information and exit
 
 Advanced options:
@@ -48,111 +90,288 @@ Advanced options:
         --matchers          number of matcher coroutines (default: 4)
         --move-buffer       size of the move buffer (default: 100)
         --movers            number of mover coroutines (default: 10)
+        --hdd-readers       readers for each spinning disk, setting this or --ssd-readers gives each device its own
+                            queue of files to match instead of --matchers (default: 0)
+        --ssd-readers       readers for each SSD, or device that can't be identified (default: 0)
+        --spill-records     files held in memory before spilling when --external is set (default: 1000000)
+        --metrics-addr      serve Prometheus metrics and pprof on this address e.g. :9090 (default: off)
+        --sample            cheap hashes to rule out candidates before the head hash, comma separated stages of
+                            head:<size>, tail:<size> or blocks:<count>x<size> e.g. tail:64K,blocks:8x4K (default: none)
 
 See <https://github.com/glxxyz/dedupe> for documentation and help.
 `
 
-func ParseParameters() (*Options, error) {
-
-	if len(os.Args) < 2 {
-		fmt.Print(usageMessage)
-		os.Exit(0)
+// checkScript makes sure there's somewhere for the script to move files to, that it can do without dedupe
+func checkScript(emitScript string, trash string, layout string, collision string, verbose bool) error {
+	switch {
+	case emitScript == "":
+		return nil
+	case emitScript != "sh" && emitScript != "ps1":
+		return fmt.Errorf("emit-script must be one of sh or ps1, but found: %v", emitScript)
+	case trash == "":
+		return errors.New("when emit-script is set then trash must also be set")
+	case trash == TrashXDG || layout == LayoutStore:
+		return errors.New("emit-script can't be used with trash=xdg: or trash-layout=store")
+	case collision != CollisionSuffix && collision != CollisionSkip:
+		// the script doesn't compare files, so the other policies would quietly skip instead
+		return fmt.Errorf("emit-script can only use on-collision=suffix or skip, but found: %v", collision)
+	case verbose:
+		return errors.New("emit-script can't be used along with verbose=true, as both write to stdout")
 	}
+	return nil
+}
 
-	trash := flag.String("trash", "", "directory for 'trashed' files")
-	modTime := flag.Bool("compare-time", false, "compare file modification time")
-	name := flag.Bool("compare-name", false, "compare file name")
-	size := flag.Bool("compare-size", true, "compare file size")
-	hash := flag.Bool("compare-hash", true, "compare file hash")
-	contents := flag.Bool("compare-contents", false, "compare file contents")
-	minSize := flag.String("min-size", "0", "minimum file size, bytes or human readable e.g. 4M, 5G")
-	symLinks := flag.Bool("follow-symlinks", false, "follow symbolic links, false ignores them")
-	verbose := flag.Bool("verbose", false, "emit verbose information")
-	version := flag.Bool("version", false, "output version and license information and exit")
-	scanBuffer := flag.Int("scan-buffer", 100, "size of the scan buffer")
-	scanners := flag.Int("scanners", 10, " number of scanner coroutines")
-	matchBuffer := flag.Int("match-buffer", 100, "size of the match buffer")
-	matchers := flag.Int("matchers", 4, " number of matcher coroutines")
-	moveBuffer := flag.Int("move-buffer", 100, "size of the move buffer")
-	movers := flag.Int("movers", 10, "number of mover coroutines")
-
-	flag.Parse()
-
-	if *version {
-		fmt.Print(versionMessage)
-		return nil, nil
+// defineScan adds the options for scan, for report which can't move files but can choose how they're written, and
+// for uniques which copies or moves the files that aren't duplicates instead
+func defineScan(flags *flag.FlagSet, command string) func(paths []string) (*Options, error) {
+	trash, format, output := new(string), new(string), new(string)
+	layout, collision, emitScript := new(string), new(string), new(string)
+	copyTo, moveTo := new(string), new(string)
+	merge, mergeLayout := new(bool), new(string)
+	hooks := func(*Options) error { return nil }
+	switch command {
+	case CommandReport:
+		format = flags.String("format", "text", "how the report is written: text or json")
+		output = flags.String("output", "", "file to write the report to instead of stdout")
+	case CommandUniques:
+		copyTo = flags.String("copy-to", "", "directory to copy the unique files to")
+		moveTo = flags.String("move-to", "", "directory to move the unique files to")
+	case CommandCompare:
+		merge = flags.Bool("merge", false, "copy the files only in the second directory into the first")
+		mergeLayout = flags.String("merge-layout", MergeMirror, "where merged files go: mirror, by-date or flat")
+	default:
+		trash = flags.String("trash", "", "directory for 'trashed' files")
+		layout, collision = defineLayout(flags)
+		emitScript = flags.String("emit-script", "", "write a sh or ps1 script to stdout that moves the duplicates, instead of moving them")
+		hooks = defineHooks(flags, true)
 	}
-
-	if !(*modTime || *name || *size || *hash || *contents) {
-		return nil, errors.New("at least one compare- option must be true")
+	// uniques and compare need every duplicate to know which files don't have one
+	scope := new(string)
+	*scope = repo.ScopeAll
+	if command != CommandUniques && command != CommandCompare {
+		scope = flags.String("scope", repo.ScopeAll, "which duplicates are acted on: cross-root, within-root or all")
 	}
+	modTime := flags.Bool("compare-time", false, "compare file modification time")
+	name := flags.Bool("compare-name", false, "compare file name")
+	size := flags.Bool("compare-size", true, "compare file size")
+	hash := flags.Bool("compare-hash", true, "compare file hash")
+	contents := flags.Bool("compare-contents", false, "compare file contents")
+	filters := defineFilters(flags)
+	symLinks := flags.Bool("follow-symlinks", false, "follow symbolic links, false ignores them")
+	hddReaders := flags.Int("hdd-readers", 0, "readers for each spinning disk, gives each device its own queue")
+	ssdReaders := flags.Int("ssd-readers", 0, "readers for each SSD, gives each device its own queue")
+	readLimits := defineReadLimits(flags)
+	external := flags.Bool("external", false, "bounded memory for huge scans, files are spilled to $TMPDIR")
+	stateDir := flags.String("state-dir", "", "save checkpoints of the directories walked and hashes calculated here")
+	resume := flags.Bool("resume", false, "continue from the last checkpoint in --state-dir")
+	progress := flags.Bool("progress", true, "show progress on stderr when it's a terminal")
+	summary := flags.String("summary", "text", "end of run summary to stderr: text, json or none")
+	verbose := flags.Bool("verbose", false, "emit verbose information")
+	version := flags.Bool("version", false, "output version and license information and exit")
+	scanBuffer := flags.Int("scan-buffer", 100, "size of the scan buffer")
+	scanners := flags.Int("scanners", 10, " number of scanner coroutines")
+	matchBuffer := flags.Int("match-buffer", 100, "size of the match buffer")
+	matchers := flags.Int("matchers", 4, " number of matcher coroutines")
+	moveBuffer := flags.Int("move-buffer", 100, "size of the move buffer")
+	movers := flags.Int("movers", 10, "number of mover coroutines")
+	spillRecords := flags.Int("spill-records", 1000000, "files held in memory before spilling when --external is set")
+	metricsAddr := flags.String("metrics-addr", "", "serve Prometheus metrics and pprof on this address")
+	sample := flags.String("sample", "", "cheap hashes to rule out candidates before the head hash e.g. tail:64K,blocks:8x4K")
 
-	if *contents && !*hash {
-		return nil, errors.New("when compare-contents=true then compare-hash=true must also be set")
-	}
+	return func(paths []string) (*Options, error) {
+		if *version {
+			fmt.Print(versionMessage)
+			return nil, nil
+		}
 
-	if *hash && !*size {
-		return nil, errors.New("when compare-hash=true then compare-size=true must also be set")
-	}
+		if command == CommandReport && *format != "text" && *format != "json" {
+			return nil, fmt.Errorf("format must be one of text or json, but found: %v", *format)
+		}
 
-	if len(flag.Args()) < 1 {
-		return nil, errors.New("at least one directory to scan must be passed in")
-	}
+		if !(*modTime || *name || *size || *hash || *contents) {
+			return nil, errors.New("at least one compare- option must be true")
+		}
 
-	minBytes, err := parseHumanReadableSize(*minSize)
-	if err != nil {
-		return nil, fmt.Errorf("couldn't parse miniumum size: %w", err)
-	}
+		if *contents && !*hash {
+			return nil, errors.New("when compare-contents=true then compare-hash=true must also be set")
+		}
 
-	if *verbose {
-		fmt.Printf("minimum file size in bytes: %v\n", minBytes)
-	}
+		if *hash && !*size {
+			return nil, errors.New("when compare-hash=true then compare-size=true must also be set")
+		}
 
-	var absoluteTrash string
-	if *trash != "" {
-		if absolute, err := filepath.Abs(*trash); err == nil {
-			absoluteTrash = absolute
-		} else {
-			return nil, fmt.Errorf("failed to get an absolute path for %q: %w", *trash, err)
+		if *scope != repo.ScopeAll && *scope != repo.ScopeCrossRoot && *scope != repo.ScopeWithinRoot {
+			return nil, fmt.Errorf("scope must be one of cross-root, within-root or all, but found: %v", *scope)
 		}
-		if _, err := os.Stat(absoluteTrash); os.IsNotExist(err) {
-			return nil, fmt.Errorf("trash path does not exist: %s\n", *trash)
+
+		if *summary != "text" && *summary != "json" && *summary != "none" {
+			return nil, fmt.Errorf("summary must be one of text, json or none, but found: %v", *summary)
+		}
+
+		samples, err := parseSamples(*sample)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(samples) > 0 && !*hash {
+			return nil, errors.New("when sample is set then compare-hash=true must also be set")
+		}
+
+		if *external && !*size {
+			return nil, errors.New("when external=true then compare-size=true must also be set")
+		}
+
+		if *hddReaders < 0 || *ssdReaders < 0 {
+			return nil, errors.New("hdd-readers and ssd-readers can't be negative")
+		}
+
+		if *resume && *stateDir == "" {
+			return nil, errors.New("when resume=true then state-dir must also be set")
+		}
+
+		if *stateDir != "" && *external {
+			return nil, errors.New("state-dir can't be used along with external=true")
+		}
+
+		if *spillRecords < 1 {
+			return nil, fmt.Errorf("spill-records must be at least one, but found: %v", *spillRecords)
+		}
+
+		if len(paths) < 1 {
+			return nil, errors.New("at least one directory to scan must be passed in")
 		}
-	}
 
-	absolutePaths := make([]string, len(flag.Args()))
-	for i, path := range flag.Args() {
-		if absolute, err := filepath.Abs(path); err == nil {
-			if _, err := os.Stat(absolute); os.IsNotExist(err) {
-				errLog.Printf("path does not exist: %s\n", *trash)
+		if command == CommandUniques && len(paths) < 2 {
+			return nil, errors.New("at least two directories must be passed in, for files unique to the others")
+		}
+
+		if command == CommandCompare {
+			if err := checkCompare(paths, *mergeLayout); err != nil {
+				return nil, err
+			}
+		}
+
+		if *copyTo != "" && *moveTo != "" {
+			return nil, errors.New("copy-to and move-to can't both be set")
+		}
+
+		var uniquesTo string
+		for _, dir := range []string{*copyTo, *moveTo} {
+			if dir == "" {
+				continue
+			} else if absolute, err := filepath.Abs(dir); err != nil {
+				return nil, fmt.Errorf("failed to get an absolute path for %q: %w", dir, err)
+			} else if info, err := os.Stat(absolute); err != nil || !info.IsDir() {
+				return nil, fmt.Errorf("directory does not exist: %s", dir)
+			} else {
+				uniquesTo = absolute
 			}
-			absolutePaths[i] = absolute
-		} else {
-			return nil, fmt.Errorf("failed to get an absolute path for %q: %w", path, err)
 		}
-	}
 
-	if *verbose {
-		fmt.Printf("System default is %d CPUs\n", runtime.NumCPU())
+		var absoluteTrash string
+		if *trash != "" {
+			if absoluteTrash, err = trashDirectory(*trash); err != nil {
+				return nil, err
+			}
+			if err := checkLayout(absoluteTrash, *layout, *collision); err != nil {
+				return nil, err
+			}
+		}
+
+		if err := checkScript(*emitScript, absoluteTrash, *layout, *collision, *verbose); err != nil {
+			return nil, err
+		}
+
+		var absoluteStateDir string
+		if *stateDir != "" {
+			if absolute, err := filepath.Abs(*stateDir); err == nil {
+				absoluteStateDir = absolute
+			} else {
+				return nil, fmt.Errorf("failed to get an absolute path for %q: %w", *stateDir, err)
+			}
+		}
+
+		absolutePaths := make([]string, len(paths))
+		for i, path := range paths {
+			if absolute, err := filepath.Abs(path); err == nil {
+				if _, err := os.Stat(absolute); os.IsNotExist(err) {
+					errLog.Printf("path does not exist: %s\n", *trash)
+				}
+				absolutePaths[i] = absolute
+			} else {
+				return nil, fmt.Errorf("failed to get an absolute path for %q: %w", path, err)
+			}
+		}
+
+		if *verbose {
+			fmt.Printf("System default is %d CPUs\n", runtime.NumCPU())
+		}
+
+		options := &Options{
+			command:      command,
+			trash:        absoluteTrash,
+			doMove:       *trash != "",
+			trashLayout:  *layout,
+			collision:    *collision,
+			emitScript:   *emitScript,
+			modTime:      *modTime,
+			name:         *name,
+			size:         *size,
+			hash:         *hash,
+			contents:     *contents,
+			samples:      samples,
+			symLinks:     *symLinks,
+			scope:        *scope,
+			verbose:      *verbose,
+			scanBuffer:   *scanBuffer,
+			scanners:     *scanners,
+			matchBuffer:  *matchBuffer,
+			matchers:     *matchers,
+			moveBuffer:   *moveBuffer,
+			movers:       *movers,
+			hddReaders:   *hddReaders,
+			ssdReaders:   *ssdReaders,
+			external:     *external,
+			spillRecords: *spillRecords,
+			stateDir:     absoluteStateDir,
+			resume:       *resume,
+			summary:      *summary,
+			progress:     *progress,
+			metricsAddr:  *metricsAddr,
+			paths:        absolutePaths,
+			format:       *format,
+			output:       *output,
+			uniquesTo:    uniquesTo,
+			uniquesMove:  *moveTo != "",
+			merge:        *merge,
+			mergeLayout:  *mergeLayout,
+		}
+		if err := filters(options); err != nil {
+			return nil, err
+		}
+		if *verbose {
+			fmt.Printf("minimum file size in bytes: %v\n", options.minBytes)
+		}
+		if err := readLimits(options); err != nil {
+			return nil, err
+		}
+		if err := hooks(options); err != nil {
+			return nil, err
+		}
+		if options.emitScript != "" && (options.onDuplicate != "" || options.onMove != "") {
+			return nil, errors.New("on-duplicate and on-move can't be used with emit-script, as nothing is moved")
+		}
+		return options, nil
 	}
+}
 
-	return &Options{
-		trash:       absoluteTrash,
-		doMove:      *trash != "",
-		modTime:     *modTime,
-		name:        *name,
-		size:        *size,
-		hash:        *hash,
-		contents:    *contents,
-		minBytes:    minBytes,
-		symLinks:    *symLinks,
-		verbose:     *verbose,
-		scanBuffer:  *scanBuffer,
-		scanners:    *scanners,
-		matchBuffer: *matchBuffer,
-		matchers:    *matchers,
-		moveBuffer:  *moveBuffer,
-		movers:      *movers,
-		paths:       absolutePaths,
-	}, nil
+// parseList splits a comma separated option, leaving out empty items
+func parseList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
 }
@@ -0,0 +1,50 @@
+package param
+
+import (
+	"fmt"
+	"github.com/glxxyz/dedupe/repo"
+	"strconv"
+	"strings"
+)
+
+// parseSamples reads a comma separated chain of stages e.g. head:64K,tail:64K,blocks:8x4K
+func parseSamples(value string) ([]repo.Sample, error) {
+	if value == "" {
+		return nil, nil
+	}
+	var samples []repo.Sample
+	for _, stage := range strings.Split(value, ",") {
+		parts := strings.SplitN(stage, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("sample stage must be kind:size e.g. head:64K, but found: %v", stage)
+		}
+		sample := repo.Sample{Kind: repo.SampleKind(parts[0])}
+		size := parts[1]
+		switch sample.Kind {
+		case repo.SampleHead, repo.SampleTail:
+		case repo.SampleBlocks:
+			blocks := strings.SplitN(size, "x", 2)
+			if len(blocks) != 2 {
+				return nil, fmt.Errorf("blocks sample must be blocks:countxsize e.g. blocks:8x4K, but found: %v", stage)
+			}
+			count, err := strconv.Atoi(blocks[0])
+			if err != nil || count < 1 {
+				return nil, fmt.Errorf("blocks sample count must be a positive integer, but found: %v", stage)
+			}
+			sample.Blocks = count
+			size = blocks[1]
+		default:
+			return nil, fmt.Errorf("sample kind must be one of head, tail or blocks, but found: %v", stage)
+		}
+		bytes, err := parseHumanReadableSize(size)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't parse sample size: %w", err)
+		}
+		if bytes < 1 {
+			return nil, fmt.Errorf("sample size must be at least one byte, but found: %v", stage)
+		}
+		sample.Bytes = bytes
+		samples = append(samples, sample)
+	}
+	return samples, nil
+}
@@ -0,0 +1,50 @@
+package param
+
+import (
+	"github.com/glxxyz/dedupe/repo"
+	"reflect"
+	"testing"
+)
+
+func Test_parseSamples(t *testing.T) {
+	successTests := []struct {
+		name  string
+		value string
+		want  []repo.Sample
+	}{
+		{"empty", "", nil},
+		{"head", "head:64K", []repo.Sample{{Kind: repo.SampleHead, Bytes: 64 * 1024}}},
+		{"chain", "tail:1M,blocks:8x4K", []repo.Sample{
+			{Kind: repo.SampleTail, Bytes: 1024 * 1024},
+			{Kind: repo.SampleBlocks, Bytes: 4 * 1024, Blocks: 8},
+		}},
+	}
+	failureTests := []struct {
+		name  string
+		value string
+	}{
+		{"no size", "head"},
+		{"unknown kind", "middle:4K"},
+		{"bad size", "tail:abc"},
+		{"zero size", "head:0"},
+		{"blocks without count", "blocks:4K"},
+		{"zero blocks", "blocks:0x4K"},
+		{"trailing comma", "head:4K,"},
+	}
+	for _, tt := range successTests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := parseSamples(tt.value); err != nil {
+				t.Errorf("parseSamples() error = %v", err)
+			} else if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseSamples() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	for _, tt := range failureTests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := parseSamples(tt.value); err == nil {
+				t.Errorf("parseSamples() got = %v, but want an error", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"github.com/glxxyz/dedupe/stats"
+	"os"
+	"strings"
+	"time"
+)
+
+type ProgressOptions interface {
+	Progress() bool
+	Verbose() bool
+}
+
+const progressInterval = 500 * time.Millisecond
+
+// spawnProgress redraws a single progress line on stderr, the returned function stops it and clears the line
+func spawnProgress(options ProgressOptions, statistics *stats.Stats) func() {
+	if !options.Progress() || options.Verbose() || !isTerminal(os.Stderr) {
+		return func() {}
+	}
+	ticker := time.NewTicker(progressInterval)
+	done := make(chan bool)
+	finished := make(chan bool)
+	go func() {
+		defer close(finished)
+		var meter throughputMeter
+		for {
+			select {
+			case <-ticker.C:
+				progress := statistics.Progress()
+				meter.update(progress.HashedBytes, progress.Elapsed)
+				fmt.Fprintf(os.Stderr, "\r%s\x1b[K", formatProgress(progress, meter.bytesPerSecond))
+			case <-done:
+				ticker.Stop()
+				fmt.Fprint(os.Stderr, "\r\x1b[K")
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-finished
+	}
+}
+
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// throughputMeter smooths the hashing rate so the ETA doesn't jump around between updates
+type throughputMeter struct {
+	lastBytes      int64
+	lastElapsed    time.Duration
+	bytesPerSecond float64
+}
+
+func (meter *throughputMeter) update(bytes int64, elapsed time.Duration) {
+	interval := (elapsed - meter.lastElapsed).Seconds()
+	if interval <= 0 {
+		return
+	}
+	rate := float64(bytes-meter.lastBytes) / interval
+	if meter.lastElapsed == 0 {
+		meter.bytesPerSecond = rate
+	} else {
+		meter.bytesPerSecond = 0.7*meter.bytesPerSecond + 0.3*rate
+	}
+	meter.lastBytes = bytes
+	meter.lastElapsed = elapsed
+}
+
+func formatProgress(progress stats.Progress, bytesPerSecond float64) string {
+	var line strings.Builder
+	fmt.Fprintf(&line, "found %d files (%s)", progress.FilesScanned, stats.HumanReadableSize(progress.BytesScanned))
+	fmt.Fprintf(&line, ", hashed %d files (%s)", progress.FullHashes, stats.HumanReadableSize(progress.HashedBytes))
+	fmt.Fprintf(&line, ", %d duplicates, %d moved", progress.Duplicates, progress.FilesMoved)
+	fmt.Fprintf(&line, ", %.1f MB/s", bytesPerSecond/(1024*1024))
+	// the total to hash isn't known until the walk completes
+	if progress.ScanFinished {
+		// candidates are either full hashed or compared, not both
+		remaining := progress.CandidateBytes - progress.FullHashedBytes - progress.ComparedBytes
+		if remaining <= 0 {
+			line.WriteString(", ETA 0s")
+		} else if bytesPerSecond > 0 {
+			eta := time.Duration(float64(remaining) / bytesPerSecond * float64(time.Second))
+			fmt.Fprintf(&line, ", ETA %v", eta.Round(time.Second))
+		}
+	}
+	return line.String()
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"github.com/glxxyz/dedupe/stats"
+	"testing"
+	"time"
+)
+
+func Test_formatProgress(t *testing.T) {
+	tests := []struct {
+		name           string
+		progress       stats.Progress
+		bytesPerSecond float64
+		want           string
+	}{
+		{
+			"walk in progress",
+			stats.Progress{FilesScanned: 10, BytesScanned: 2048, FullHashes: 2, HashedBytes: 1024, Duplicates: 1},
+			1024 * 1024,
+			"found 10 files (2.0K), hashed 2 files (1.0K), 1 duplicates, 0 moved, 1.0 MB/s",
+		},
+		{
+			"walk finished",
+			stats.Progress{FilesScanned: 10, CandidateBytes: 30 * 1024 * 1024, FullHashedBytes: 10 * 1024 * 1024, ScanFinished: true},
+			2 * 1024 * 1024,
+			"found 10 files (0), hashed 0 files (0), 0 duplicates, 0 moved, 2.0 MB/s, ETA 10s",
+		},
+		{
+			"everything hashed",
+			stats.Progress{CandidateBytes: 100, FullHashedBytes: 100, ScanFinished: true},
+			0,
+			"found 0 files (0), hashed 0 files (0), 0 duplicates, 0 moved, 0.0 MB/s, ETA 0s",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatProgress(tt.progress, tt.bytesPerSecond); got != tt.want {
+				t.Errorf("formatProgress() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_throughputMeter(t *testing.T) {
+	var meter throughputMeter
+	meter.update(1000, time.Second)
+	if meter.bytesPerSecond != 1000 {
+		t.Errorf("first update bytesPerSecond = %v, want 1000", meter.bytesPerSecond)
+	}
+	meter.update(1000, 2*time.Second)
+	if meter.bytesPerSecond != 700 {
+		t.Errorf("second update bytesPerSecond = %v, want 700", meter.bytesPerSecond)
+	}
+}
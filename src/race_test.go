@@ -0,0 +1,8 @@
+//go:build race
+// +build race
+
+package main_test
+
+func init() {
+	buildFlags = append(buildFlags, "-race")
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"github.com/glxxyz/dedupe/repo"
+)
+
+type ReadOptions interface {
+	MaxReadRate() int64
+	MaxIOPS() int64
+	Background() bool
+	Verbose() bool
+}
+
+// fileReader reads whole files outside of the scanner, e.g. to hash them for the store or a catalog, with the same
+// limits as the scanner. A scan shares its throttle with the scanner, so the limits apply to every read in the run.
+type fileReader struct {
+	throttle   *repo.Throttle
+	background bool
+}
+
+// newFileReader doesn't set the idle I/O priority for --background, as a scan already has
+func newFileReader(options ReadOptions) *fileReader {
+	return &fileReader{
+		throttle:   repo.NewThrottle(options.MaxReadRate(), options.MaxIOPS()),
+		background: options.Background(),
+	}
+}
+
+func (reader *fileReader) Throttle() *repo.Throttle {
+	return reader.throttle
+}
+
+func (reader *fileReader) Background() bool {
+	return reader.background
+}
@@ -0,0 +1,148 @@
+package repo
+
+import (
+	"bytes"
+	"github.com/glxxyz/dedupe/stats"
+	"hash/crc64"
+	"io"
+	"os"
+)
+
+const compareBlockSize = 64 * 1024
+
+// above this files are reopened for each block rather than kept open, to stay inside file descriptor limits
+const maxOpenFiles = 256
+
+var crcTable = crc64.MakeTable(crc64.ECMA)
+
+type compareFile struct {
+	file       *FileData
+	handle     *os.File
+	crc        uint64
+	background bool
+}
+
+// splitByContents reads all the files in lockstep a block at a time, in the style of fdupes and jdupes. A set is
+// split as soon as its blocks differ, and files left on their own are dropped, so each byte is read at most once.
+func splitByContents(options MatchOptions, statistics *stats.Stats, files []*FileData) [][]*compareFile {
+	keepOpen := len(files) <= maxOpenFiles
+	set := make([]*compareFile, 0, len(files))
+	for _, file := range files {
+		compare := &compareFile{file: file, background: options.Background()}
+		if keepOpen {
+			handle, err := os.Open(file.filePath)
+			if err != nil {
+				errLog.Printf("error opening file: %v\n", err)
+				statistics.Error(stats.ErrorOpen)
+				continue
+			}
+			compare.handle = handle
+		}
+		set = append(set, compare)
+	}
+
+	var identical [][]*compareFile
+	pending := []*compareSet{{files: set}}
+	scratch := make([]byte, compareBlockSize)
+	for len(pending) > 0 {
+		current := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		for {
+			if len(current.files) < 2 {
+				closeAll(current.files)
+				break
+			}
+			partitions, finished := current.readBlock(options, statistics, scratch)
+			if len(partitions) == 1 && finished {
+				closeAll(partitions[0].files)
+				if len(partitions[0].files) > 1 {
+					identical = append(identical, partitions[0].files)
+				}
+				break
+			} else if len(partitions) == 1 {
+				current = partitions[0]
+			} else {
+				pending = append(pending, partitions...)
+				break
+			}
+		}
+	}
+	return identical
+}
+
+type compareSet struct {
+	files  []*compareFile
+	offset int64
+}
+
+// readBlock reads the next block of every file in the set, partitioned by content
+func (set *compareSet) readBlock(options MatchOptions, statistics *stats.Stats, scratch []byte) ([]*compareSet, bool) {
+	var partitions []*compareSet
+	var blocks [][]byte
+	finished := true
+	for _, compare := range set.files {
+		count, err := compare.readAt(scratch, set.offset)
+		options.Throttle().wait(statistics, count)
+		if err != nil {
+			errLog.Printf("error reading from file: %v\n", err)
+			statistics.Error(stats.ErrorRead)
+			compare.close()
+			continue
+		}
+		statistics.Compared(int64(count))
+		block := scratch[:count]
+		compare.crc = crc64.Update(compare.crc, crcTable, block)
+		if count == len(scratch) {
+			finished = false
+		}
+		found := false
+		for num, existing := range blocks {
+			if bytes.Equal(existing, block) {
+				partitions[num].files = append(partitions[num].files, compare)
+				found = true
+				break
+			}
+		}
+		if !found {
+			blocks = append(blocks, append([]byte(nil), block...))
+			partitions = append(partitions, &compareSet{files: []*compareFile{compare}, offset: set.offset + int64(count)})
+		}
+	}
+	return partitions, finished
+}
+
+func (compare *compareFile) readAt(data []byte, offset int64) (int, error) {
+	handle := compare.handle
+	if handle == nil {
+		var err error
+		if handle, err = os.Open(compare.file.filePath); err != nil {
+			return 0, err
+		}
+		defer compare.closeHandle(handle)
+	}
+	count, err := handle.ReadAt(data, offset)
+	if err == io.EOF {
+		err = nil
+	}
+	return count, err
+}
+
+func (compare *compareFile) close() {
+	if compare.handle != nil {
+		compare.closeHandle(compare.handle)
+		compare.handle = nil
+	}
+}
+
+func (compare *compareFile) closeHandle(handle *os.File) {
+	if compare.background {
+		dropCache(handle)
+	}
+	handle.Close()
+}
+
+func closeAll(files []*compareFile) {
+	for _, compare := range files {
+		compare.close()
+	}
+}
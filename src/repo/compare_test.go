@@ -0,0 +1,132 @@
+package repo
+
+import (
+	"bytes"
+	"github.com/glxxyz/dedupe/stats"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+type testOptions struct {
+	contents bool
+	samples  []Sample
+	paths    []string
+	scope    string
+	readers  int
+}
+
+func (options *testOptions) ModTime() bool            { return false }
+func (options *testOptions) Name() bool               { return false }
+func (options *testOptions) Size() bool               { return true }
+func (options *testOptions) Hash() bool               { return true }
+func (options *testOptions) Contents() bool           { return options.contents }
+func (options *testOptions) Samples() []Sample        { return options.samples }
+func (options *testOptions) MinBytes() int64          { return 0 }
+func (options *testOptions) SymLinks() bool           { return false }
+func (options *testOptions) Verbose() bool            { return false }
+func (options *testOptions) Throttle() *Throttle      { return nil }
+func (options *testOptions) Background() bool         { return false }
+func (options *testOptions) Matchers() int            { return 2 }
+func (options *testOptions) DeviceReaders(uint64) int { return options.readers }
+func (options *testOptions) Paths() []string          { return options.paths }
+func (options *testOptions) Scope() string            { return options.scope }
+
+func writeTestFiles(t *testing.T, contents map[string][]byte) []*FileData {
+	dir := t.TempDir()
+	var files []*FileData
+	for name, content := range contents {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, content, 0644); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, &FileData{filePath: path, size: int64(len(content))})
+	}
+	return files
+}
+
+func Test_splitByContents(t *testing.T) {
+	size := 3*compareBlockSize + 100
+	original := bytes.Repeat([]byte("0123456789"), size/10)
+	differentEnd := append(append([]byte{}, original[:len(original)-1]...), 'x')
+	differentStart := append([]byte{'x'}, original[1:]...)
+	other := bytes.Repeat([]byte("abcdefghij"), size/10)
+	files := writeTestFiles(t, map[string][]byte{
+		"a":       original,
+		"b":       original,
+		"c":       original,
+		"d":       differentEnd,
+		"e":       differentStart,
+		"f":       other,
+		"g":       other,
+		"missing": original,
+	})
+	for _, file := range files {
+		if filepath.Base(file.filePath) == "missing" {
+			os.Remove(file.filePath)
+		}
+	}
+
+	statistics := stats.New(nil)
+	sets := splitByContents(&testOptions{contents: true}, statistics, files)
+	var got [][]string
+	for _, set := range sets {
+		var names []string
+		for _, compare := range set {
+			names = append(names, filepath.Base(compare.file.filePath))
+			if compare.crc != set[0].crc {
+				t.Errorf("crc of %v differs from %v", names[len(names)-1], names[0])
+			}
+		}
+		sort.Strings(names)
+		got = append(got, names)
+	}
+	sort.Slice(got, func(i, j int) bool { return got[i][0] < got[j][0] })
+	want := [][]string{{"a", "b", "c"}, {"f", "g"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("splitByContents() = %v, want %v", got, want)
+	}
+
+	// a, b, c, d, f and g are read in full, e only until its first block differs
+	wantBytes := int64(6*len(original) + compareBlockSize)
+	if compared := statistics.Summary().ComparedBytes; compared != wantBytes {
+		t.Errorf("compared %d bytes, want each byte read once: %d", compared, wantBytes)
+	}
+	if errors := statistics.Summary().Errors[stats.ErrorOpen]; errors != 1 {
+		t.Errorf("open errors = %d, want 1 for the missing file", errors)
+	}
+}
+
+func TestGroupsDeviceReaders(t *testing.T) {
+	files := writeTestFiles(t, map[string][]byte{
+		"a": []byte("first contents"),
+		"b": []byte("first contents"),
+		"c": []byte("other contents"),
+		"d": []byte("other contents"),
+	})
+	options := &testOptions{contents: true, readers: 1}
+	matchRepo := NewMatchRepository(stats.New(nil))
+	for _, file := range files {
+		matchRepo.Add(options, file)
+	}
+	groups := make(chan Group, 10)
+	matchRepo.Groups(options, groups)
+	close(groups)
+	var got []string
+	for group := range groups {
+		var names []string
+		for _, file := range group.Files {
+			names = append(names, filepath.Base(file.filePath))
+		}
+		sort.Strings(names)
+		got = append(got, strings.Join(names, ","))
+	}
+	sort.Strings(got)
+	if want := []string{"a,b", "c,d"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Groups() = %v, want %v", got, want)
+	}
+}
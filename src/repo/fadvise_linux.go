@@ -0,0 +1,17 @@
+//go:build linux && (amd64 || arm64 || riscv64 || ppc64le || s390x)
+// +build linux
+// +build amd64 arm64 riscv64 ppc64le s390x
+
+package repo
+
+import (
+	"os"
+	"syscall"
+)
+
+const fadviseDontNeed = 4
+
+// dropCache tells the kernel the file won't be read again, so hashing doesn't push everything else out of the page cache
+func dropCache(file *os.File) {
+	syscall.Syscall6(syscall.SYS_FADVISE64, file.Fd(), 0, 0, fadviseDontNeed, 0, 0)
+}
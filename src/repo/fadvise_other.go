@@ -0,0 +1,10 @@
+//go:build !linux || !(amd64 || arm64 || riscv64 || ppc64le || s390x)
+// +build !linux !amd64,!arm64,!riscv64,!ppc64le,!s390x
+
+package repo
+
+import "os"
+
+// dropCache isn't supported here
+func dropCache(file *os.File) {
+}
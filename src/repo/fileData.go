@@ -1,7 +1,10 @@
 package repo
 
 import (
+	"github.com/glxxyz/dedupe/stats"
 	"os"
+	"path/filepath"
+	"sync"
 	"time"
 )
 
@@ -10,25 +13,157 @@ type FileData struct {
 	name     string
 	size     int64
 	modTime  time.Time
+	device   uint64
+
+	// hashes are calculated at most once, the first time each one is needed
+	lock    sync.Mutex
+	head    *cachedHash
+	full    *cachedHash
+	samples map[string]*cachedHash // keyed by Sample.String()
+}
+
+type cachedHash struct {
+	value uint64
+	err   error
 }
 
 func NewFile(options MatchOptions, filePath string, info os.FileInfo) *FileData {
 	var name string
 	var modTime time.Time
-	var size int64
 	if options.Name() {
 		name = info.Name()
 	}
 	if options.ModTime() {
 		modTime = info.ModTime()
 	}
-	if options.Size() {
-		size = info.Size()
-	}
 	return &FileData{
 		filePath: filePath,
 		name:     name,
-		size:     size,
+		size:     info.Size(),
 		modTime:  modTime,
+		device:   deviceOf(info),
+	}
+}
+
+// RestoreFile recreates a file that was written out along with its size and modification time, e.g. when spilling
+// to disk, the name comes from the path
+func RestoreFile(options MatchOptions, filePath string, size int64, modTime time.Time) *FileData {
+	file := &FileData{filePath: filePath, size: size}
+	if options.Name() {
+		file.name = filepath.Base(filePath)
+	}
+	if options.ModTime() {
+		file.modTime = modTime
+	}
+	return file
+}
+
+func (file *FileData) Path() string {
+	return file.filePath
+}
+
+func (file *FileData) Size() int64 {
+	return file.size
+}
+
+// Device is the device the file is stored on, it's zero if that isn't known
+func (file *FileData) Device() uint64 {
+	return file.device
+}
+
+// ModTime is only set when it's compared
+func (file *FileData) ModTime() time.Time {
+	return file.modTime
+}
+
+// FileHashes are the hashes calculated so far for a file, so they can be saved and restored
+type FileHashes struct {
+	Head    uint32
+	HasHead bool
+	Full    uint64
+	HasFull bool
+	Samples map[string]uint64 // keyed by Sample.String()
+}
+
+// Hashes returns the hashes that have been calculated without errors
+func (file *FileData) Hashes() FileHashes {
+	file.lock.Lock()
+	defer file.lock.Unlock()
+	var hashes FileHashes
+	if file.head != nil && file.head.err == nil {
+		hashes.Head, hashes.HasHead = uint32(file.head.value), true
+	}
+	if file.full != nil && file.full.err == nil {
+		hashes.Full, hashes.HasFull = file.full.value, true
+	}
+	for key, cache := range file.samples {
+		if cache.err == nil {
+			if hashes.Samples == nil {
+				hashes.Samples = make(map[string]uint64)
+			}
+			hashes.Samples[key] = cache.value
+		}
+	}
+	return hashes
+}
+
+// SetHashes must only be called with hashes of the file's current contents, before it's added to a MatchRepository
+func (file *FileData) SetHashes(hashes FileHashes) {
+	file.lock.Lock()
+	defer file.lock.Unlock()
+	if hashes.HasHead {
+		file.head = &cachedHash{value: uint64(hashes.Head)}
+	}
+	if hashes.HasFull {
+		file.full = &cachedHash{value: hashes.Full}
+	}
+	for key, value := range hashes.Samples {
+		if file.samples == nil {
+			file.samples = make(map[string]*cachedHash)
+		}
+		file.samples[key] = &cachedHash{value: value}
+	}
+}
+
+func (file *FileData) headHash(options HashOptions, statistics *stats.Stats) (uint32, error) {
+	file.lock.Lock()
+	defer file.lock.Unlock()
+	hash, err := file.cached(&file.head, statistics, func() (uint64, error) {
+		hash, err := calculateHeadHash(options, statistics, file.filePath)
+		return uint64(hash), err
+	})
+	return uint32(hash), err
+}
+
+func (file *FileData) fullHash(options HashOptions, statistics *stats.Stats) (uint64, error) {
+	file.lock.Lock()
+	defer file.lock.Unlock()
+	return file.cached(&file.full, statistics, func() (uint64, error) {
+		return calculateFullHash(options, statistics, file.filePath)
+	})
+}
+
+func (file *FileData) sampleHash(options HashOptions, statistics *stats.Stats, sample Sample) (uint64, error) {
+	file.lock.Lock()
+	defer file.lock.Unlock()
+	if file.samples == nil {
+		file.samples = make(map[string]*cachedHash)
+	}
+	cache := file.samples[sample.String()]
+	hash, err := file.cached(&cache, statistics, func() (uint64, error) {
+		return calculateSampleHash(options, statistics, sample, file)
+	})
+	file.samples[sample.String()] = cache
+	return hash, err
+}
+
+// cached must be called with the lock held, errors are kept too so a file that can't be read is only reported once
+func (file *FileData) cached(cache **cachedHash, statistics *stats.Stats, calculate func() (uint64, error)) (uint64, error) {
+	if *cache != nil {
+		statistics.HashCached()
+		return (*cache).value, (*cache).err
 	}
+	value, err := calculate()
+	*cache = &cachedHash{value: value, err: err}
+	return value, err
 }
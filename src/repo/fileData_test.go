@@ -0,0 +1,48 @@
+package repo
+
+import (
+	"fmt"
+	"github.com/glxxyz/dedupe/stats"
+	"sync"
+	"testing"
+)
+
+func TestHashedOncePerStage(t *testing.T) {
+	contents := make(map[string][]byte)
+	for i := 0; i < 20; i++ {
+		contents[fmt.Sprintf("file%d", i)] = []byte("identical contents")
+	}
+	files := writeTestFiles(t, contents)
+	options := &testOptions{samples: []Sample{{Kind: SampleTail, Bytes: 4}}}
+	statistics := stats.New(nil)
+	matchRepo := NewMatchRepository(statistics)
+	var adders sync.WaitGroup
+	for _, file := range files {
+		adders.Add(1)
+		go func(file *FileData) {
+			defer adders.Done()
+			matchRepo.Add(options, file)
+		}(file)
+	}
+	adders.Wait()
+
+	summary := statistics.Summary()
+	if summary.Samples[0].Files != 20 || summary.HeadHashes != 20 || summary.FullHashes != 20 {
+		t.Errorf("hashed %d samples, %d heads, %d full, want each of the 20 files hashed once per stage",
+			summary.Samples[0].Files, summary.HeadHashes, summary.FullHashes)
+	}
+	if summary.CachedHashes != 0 {
+		t.Errorf("Summary().CachedHashes = %d, want 0", summary.CachedHashes)
+	}
+
+	first, err := files[0].fullHash(options, statistics)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _ := files[1].fullHash(options, statistics)
+	summary = statistics.Summary()
+	if first != second || summary.FullHashes != 20 || summary.CachedHashes != 2 {
+		t.Errorf("fullHash() again read %d files and cached %d, want the 2 cached hashes reused",
+			summary.FullHashes-20, summary.CachedHashes)
+	}
+}
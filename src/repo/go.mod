@@ -1,3 +1,7 @@
 module github.com/glxxyz/dedupe/repo
 
 go 1.14
+
+replace github.com/glxxyz/dedupe/stats v0.0.0 => ../stats
+
+require github.com/glxxyz/dedupe/stats v0.0.0
@@ -0,0 +1,22 @@
+package repo
+
+// The scopes, which duplicates can be acted on depending on the roots they're in
+const (
+	ScopeAll        = "all"         // every duplicate, the default
+	ScopeCrossRoot  = "cross-root"  // only those in a different root to the file kept
+	ScopeWithinRoot = "within-root" // only those in the same root as another, each root keeps a file
+)
+
+// Group is a set of duplicate files in priority order, the first is the one to keep
+type Group struct {
+	Files []*FileData
+	Hash  uint64 // full hash, zero when not hashing
+}
+
+func (group *Group) Keep() *FileData {
+	return group.Files[0]
+}
+
+func (group *Group) Duplicates() []*FileData {
+	return group.Files[1:]
+}
@@ -0,0 +1,44 @@
+package repo
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_scoped(t *testing.T) {
+	// in priority order, as newGroup sorts them
+	paths := []string{"/photos/a", "/photos/b", "/unsorted/x", "/unsorted/y", "/backup/z"}
+	files := make([]*FileData, len(paths))
+	for i, path := range paths {
+		files[i] = &FileData{filePath: path}
+	}
+	tests := []struct {
+		name  string
+		scope string
+		files []*FileData
+		want  [][]string
+	}{
+		{"all", ScopeAll, files, [][]string{paths}},
+		{"default", "", files, [][]string{paths}},
+		{"cross-root", ScopeCrossRoot, files, [][]string{{"/photos/a", "/unsorted/x", "/unsorted/y", "/backup/z"}}},
+		{"cross-root within one root", ScopeCrossRoot, files[2:4], nil},
+		{"within-root", ScopeWithinRoot, files, [][]string{{"/photos/a", "/photos/b"}, {"/unsorted/x", "/unsorted/y"}}},
+		{"within-root across roots", ScopeWithinRoot, []*FileData{files[0], files[2], files[4]}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := &testOptions{paths: []string{"/photos", "/unsorted", "/backup"}, scope: tt.scope}
+			var got [][]string
+			for _, group := range scoped(options, Group{Files: tt.files}) {
+				var groupPaths []string
+				for _, file := range group.Files {
+					groupPaths = append(groupPaths, file.filePath)
+				}
+				got = append(got, groupPaths)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("scoped() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
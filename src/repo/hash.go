@@ -1,110 +1,150 @@
 package repo
 
 import (
-	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/glxxyz/dedupe/stats"
 	"hash/crc32"
 	"hash/crc64"
 	"io"
 	"os"
 )
 
+// ReadOptions apply to every read of a file
+type ReadOptions interface {
+	Throttle() *Throttle
+	Background() bool
+}
+
 type HashOptions interface {
+	ReadOptions
 	Hash() bool
 	Contents() bool
 	Verbose() bool
 }
 
 // The idea of hashing the first few bytes came from https://stackoverflow.com/questions/748675/finding-duplicate-files-and-removing-them
-func calculateHeadHash(options HashOptions, path string) (uint32, error) {
+func calculateHeadHash(options HashOptions, statistics *stats.Stats, path string) (uint32, error) {
 	if !options.Hash() {
 		return 0, nil
 	}
 	file, err := os.Open(path)
 	if err != nil {
 		errLog.Printf("unable to open file: %v\n", err)
+		statistics.Error(stats.ErrorOpen)
 		return 0, err
 	}
 	defer file.Close()
 	data := make([]byte, 1024)
-	_, err = file.Read(data)
+	count, err := file.Read(data)
+	options.Throttle().wait(statistics, count)
+	if options.Background() {
+		dropCache(file)
+	}
 	if err != nil && err != io.EOF {
 		errLog.Printf("error reading from file: %v\n", err)
+		statistics.Error(stats.ErrorRead)
 		return 0, err
 	}
+	statistics.HeadHashed(int64(count))
 	return crc32.ChecksumIEEE(data), nil
 }
 
-func calculateFullHash(options HashOptions, path string) (uint64, error) {
-	if !options.Hash() {
+// calculateSampleHash reads the parts of the file chosen by sample, sampling is only used along with the other hashes
+func calculateSampleHash(options HashOptions, statistics *stats.Stats, sample Sample, file *FileData) (uint64, error) {
+	handle, err := os.Open(file.filePath)
+	if err != nil {
+		errLog.Printf("unable to open file: %v\n", err)
+		statistics.Error(stats.ErrorOpen)
+		return 0, err
+	}
+	defer handle.Close()
+	digest := crc64.New(crcTable)
+	data := make([]byte, 8*1024)
+	var total int64
+	for _, part := range sample.ranges(file.size) {
+		section := &throttledReader{io.NewSectionReader(handle, part.offset, part.length), options.Throttle(), statistics}
+		count, err := io.CopyBuffer(digest, section, data)
+		total += count
+		if err != nil {
+			errLog.Printf("error reading from file: %v\n", err)
+			statistics.Error(stats.ErrorRead)
+			return 0, err
+		}
+	}
+	if options.Background() {
+		dropCache(handle)
+	}
+	statistics.SampleHashed(sample.String(), total)
+	return digest.Sum64(), nil
+}
+
+// When comparing contents the full hash is skipped, contents are compared in a single pass by splitByContents instead
+func calculateFullHash(options HashOptions, statistics *stats.Stats, path string) (uint64, error) {
+	if !options.Hash() || options.Contents() {
 		return 0, nil
 	}
 	file, err := os.Open(path)
 	if err != nil {
 		errLog.Printf("unable to open file: %v\n", err)
+		statistics.Error(stats.ErrorOpen)
 		return 0, err
 	}
 	defer file.Close()
 	data := make([]byte, 8*1024)
-	table := crc64.MakeTable(crc64.ECMA)
 	var crc uint64
+	var total int64
 	for {
-		_, err := file.Read(data)
+		count, err := file.Read(data)
+		options.Throttle().wait(statistics, count)
 		if err == io.EOF {
 			break
 		} else if err != nil {
 			errLog.Printf("error reading from file: %v\n", err)
+			statistics.Error(stats.ErrorRead)
 			return 0, err
 		}
-		crc = crc64.Update(crc, table, data)
+		total += int64(count)
+		crc = crc64.Update(crc, crcTable, data[:count])
+	}
+	if options.Background() {
+		dropCache(file)
 	}
+	statistics.FullHashed(total)
 	return crc, nil
 }
 
-func fullByteMatch(options MatchOptions, pathA string, pathB string) (bool, error) {
-	if !options.Contents() {
-		return true, nil
-	}
-
-	fileA, err := os.Open(pathA)
+// Digest is the SHA-256 of a file's contents as hex, for commands that keep a record of the files they've read
+func Digest(options ReadOptions, statistics *stats.Stats, path string) (string, error) {
+	file, err := os.Open(path)
 	if err != nil {
-		errLog.Printf("error opening file: %v\n", err)
-		return false, err
+		errLog.Printf("unable to open file: %v\n", err)
+		statistics.Error(stats.ErrorOpen)
+		return "", err
+	}
+	defer file.Close()
+	digest := sha256.New()
+	total, err := io.CopyBuffer(digest, &throttledReader{file, options.Throttle(), statistics}, make([]byte, 8*1024))
+	if options.Background() {
+		dropCache(file)
 	}
-	defer fileA.Close()
-
-	fileB, err := os.Open(pathB)
 	if err != nil {
-		errLog.Printf("error opening file %v\n", err)
-		return false, err
+		errLog.Printf("error reading from file: %v\n", err)
+		statistics.Error(stats.ErrorRead)
+		return "", err
 	}
-	defer fileB.Close()
-
-	dataA := make([]byte, 8*1024)
-	dataB := make([]byte, 8*1024)
-
-	for {
-		bytesA, err := fileA.Read(dataA)
-		if err != nil && err != io.EOF {
-			errLog.Printf("error reading from file: %v\n", err)
-			return false, err
-		}
-
-		bytesB, err := fileB.Read(dataB)
-		if err != nil && err != io.EOF {
-			errLog.Printf("error reading from file: %v\n", err)
-			return false, err
-		}
-
-		if bytesA == 0 && bytesB == 0 {
-			return true, nil
-		}
+	statistics.FullHashed(total)
+	return hex.EncodeToString(digest.Sum(nil)), nil
+}
 
-		if bytesA != bytesB {
-			return false, nil
-		}
+type throttledReader struct {
+	reader     io.Reader
+	throttle   *Throttle
+	statistics *stats.Stats
+}
 
-		if !bytes.Equal(dataA, dataB) {
-			return false, nil
-		}
-	}
+func (throttled *throttledReader) Read(p []byte) (int, error) {
+	count, err := throttled.reader.Read(p)
+	throttled.throttle.wait(throttled.statistics, count)
+	return count, err
 }
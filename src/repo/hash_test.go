@@ -0,0 +1,25 @@
+package repo
+
+import (
+	"github.com/glxxyz/dedupe/stats"
+	"testing"
+)
+
+func TestDigest(t *testing.T) {
+	files := writeTestFiles(t, map[string][]byte{"abc": []byte("abc")})
+	statistics := stats.New(nil)
+	want := "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"
+	if got, err := Digest(&testOptions{}, statistics, files[0].filePath); err != nil || got != want {
+		t.Errorf("Digest() = %q, %v, want %q", got, err, want)
+	}
+	if _, err := Digest(&testOptions{}, statistics, files[0].filePath+".missing"); err == nil {
+		t.Error("Digest() of a missing file succeeded, want an error")
+	}
+	summary := statistics.Summary()
+	if summary.Errors[stats.ErrorOpen] != 1 {
+		t.Errorf("open errors = %d, want 1 for the missing file", summary.Errors[stats.ErrorOpen])
+	}
+	if summary.FullHashedBytes != 3 {
+		t.Errorf("full hashed bytes = %d, want 3", summary.FullHashedBytes)
+	}
+}
@@ -1,35 +1,38 @@
 package repo
 
 import (
+	"github.com/glxxyz/dedupe/stats"
 	"sync"
 )
 
 type matchAttributes struct {
 	lock       sync.Mutex
-	singlePath string
-	headMap    sync.Map // uint32 -> *matchHeadHash
+	singleFile *FileData
+	samples    matchSample // the first sampling stage, or straight to the head hash if there are none
 }
 
-func (attributes *matchAttributes) findHeadMatch(options MatchOptions, filePath string) (*matchHeadHash, bool) {
-	attributes.ensureMapExists(options)
-	hash, err := calculateHeadHash(options, filePath)
-	if err != nil {
-		return nil, false
+// findHeadMatch is only called once a second file with the same attributes is found, so both are candidates for hashing
+func (attributes *matchAttributes) findHeadMatch(options MatchOptions, statistics *stats.Stats, file *FileData) (*matchHeadHash, bool) {
+	attributes.ensureMapExists(options, statistics)
+	if options.Hash() {
+		statistics.Candidate(file.size)
 	}
-	actual, loaded := attributes.headMap.LoadOrStore(hash, &matchHeadHash{singlePath: filePath})
-	return actual.(*matchHeadHash), loaded
+	return attributes.samples.find(options, statistics, file)
 }
 
-func (attributes *matchAttributes) ensureMapExists(options MatchOptions) {
-	if attributes.singlePath != "" {
-		attributes.lock.Lock()
-		defer attributes.lock.Unlock()
-		if attributes.singlePath != "" {
-			hash, err := calculateHeadHash(options, attributes.singlePath)
-			if err == nil {
-				attributes.headMap.Store(hash, &matchHeadHash{singlePath: attributes.singlePath})
-				attributes.singlePath = ""
-			}
+func (attributes *matchAttributes) ensureMapExists(options MatchOptions, statistics *stats.Stats) {
+	attributes.lock.Lock()
+	defer attributes.lock.Unlock()
+	if attributes.singleFile != nil {
+		if options.Hash() {
+			statistics.Candidate(attributes.singleFile.size)
 		}
+		// a file that can't be hashed can't match anything, so it's dropped either way
+		attributes.samples.find(options, statistics, attributes.singleFile)
+		attributes.singleFile = nil
 	}
 }
+
+func (attributes *matchAttributes) forEachFullHash(f func(fullHash *matchFullHash)) {
+	attributes.samples.forEachFullHash(f)
+}
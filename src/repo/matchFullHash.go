@@ -1,39 +1,119 @@
 package repo
 
 import (
-	"fmt"
+	"github.com/glxxyz/dedupe/stats"
+	"sort"
 	"strings"
 	"sync"
 )
 
 type matchFullHash struct {
-	lock      sync.Mutex
-	filePaths []string
+	lock  sync.Mutex
+	hash  uint64
+	files []*FileData
 }
 
-func (fullHash *matchFullHash) lowestPriorityMatch(options MatchOptions, filePath string) (string, bool) {
+func (fullHash *matchFullHash) add(file *FileData) {
 	fullHash.lock.Lock()
 	defer fullHash.lock.Unlock()
-	for num, testPath := range fullHash.filePaths {
-		match, _ := fullByteMatch(options, testPath, filePath)
-		if match {
-			var higher, lower string
-			if firstIsHigherPriority(options.Paths(), testPath, filePath) {
-				higher, lower = testPath, filePath
+	fullHash.files = append(fullHash.files, file)
+}
+
+// groups splits the files into sets with identical contents, only called once all files have been added
+func (fullHash *matchFullHash) groups(options MatchOptions, statistics *stats.Stats) []Group {
+	if len(fullHash.files) < 2 {
+		return nil
+	}
+	if !options.Contents() {
+		return scoped(options, newGroup(options, fullHash.files, fullHash.hash))
+	}
+	var groups []Group
+	for _, set := range splitByContents(options, statistics, fullHash.files) {
+		files := make([]*FileData, len(set))
+		for i, compare := range set {
+			files[i] = compare.file
+		}
+		// the full hash is skipped when comparing contents, it's calculated along the way instead
+		groups = append(groups, scoped(options, newGroup(options, files, set[0].crc))...)
+	}
+	return groups
+}
+
+// devices are the ones the files are on in order, or none when devices don't have readers of their own
+func (fullHash *matchFullHash) devices(options MatchOptions) []uint64 {
+	var devices []uint64
+	seen := make(map[uint64]bool)
+	for _, file := range fullHash.files {
+		if options.DeviceReaders(file.Device()) == 0 {
+			return nil
+		}
+		if !seen[file.Device()] {
+			seen[file.Device()] = true
+			devices = append(devices, file.Device())
+		}
+	}
+	sort.Slice(devices, func(i, j int) bool {
+		return devices[i] < devices[j]
+	})
+	return devices
+}
+
+func newGroup(options MatchOptions, files []*FileData, hash uint64) Group {
+	sort.SliceStable(files, func(i, j int) bool {
+		return firstIsHigherPriority(options.Paths(), files[i].filePath, files[j].filePath)
+	})
+	return Group{Files: files, Hash: hash}
+}
+
+// scoped keeps the duplicates that the scope says can be acted on, splitting the group by root for ScopeWithinRoot
+func scoped(options MatchOptions, group Group) []Group {
+	switch options.Scope() {
+	case ScopeCrossRoot:
+		keepRoot := RootOf(options.Paths(), group.Keep().filePath)
+		files := []*FileData{group.Keep()}
+		for _, file := range group.Duplicates() {
+			if RootOf(options.Paths(), file.filePath) != keepRoot {
+				files = append(files, file)
+			}
+		}
+		if len(files) < 2 {
+			return nil
+		}
+		return []Group{{Files: files, Hash: group.Hash}}
+	case ScopeWithinRoot:
+		// the files are in priority order, so the first in each root is the one it keeps
+		var groups []Group
+		byRoot := make(map[int]int)
+		for _, file := range group.Files {
+			root := RootOf(options.Paths(), file.filePath)
+			if i, ok := byRoot[root]; ok {
+				groups[i].Files = append(groups[i].Files, file)
 			} else {
-				fullHash.filePaths[num] = filePath
-				higher, lower = filePath, testPath
+				byRoot[root] = len(groups)
+				groups = append(groups, Group{Files: []*FileData{file}, Hash: group.Hash})
 			}
-			fmt.Printf(
-				"Dupe:\t%v\t%v\n",
-				strings.Replace(higher, " ", "\\ ", -1),
-				strings.Replace(lower, " ", "\\ ", -1))
-			return lower, true
+		}
+		var duplicates []Group
+		for _, group := range groups {
+			if len(group.Files) > 1 {
+				duplicates = append(duplicates, group)
+			}
+		}
+		return duplicates
+	default:
+		return []Group{group}
+	}
+}
+
+// RootOf is the index of the first of the priority paths a file is under, the root that firstIsHigherPriority gives
+// it the priority of, or -1 if it isn't under any
+func RootOf(priorityPaths []string, path string) int {
+	for i, priority := range priorityPaths {
+		if strings.Index(path, priority) == 0 {
+			return i
 		}
 	}
-	// There was no match, this implies a hash collision or a problem comparing the file
-	fullHash.filePaths = append(fullHash.filePaths, filePath)
-	return "", false
+	return -1
 }
 
 func firstIsHigherPriority(priorityPaths []string, first string, second string) bool {
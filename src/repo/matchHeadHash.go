@@ -1,33 +1,35 @@
 package repo
 
-import "sync"
+import (
+	"github.com/glxxyz/dedupe/stats"
+	"sync"
+)
 
 type matchHeadHash struct {
 	lock        sync.Mutex
-	singlePath  string
+	singleFile  *FileData
 	fullHashMap sync.Map // uint64 -> *matchFullHash
 }
 
-func (headHash *matchHeadHash) findFullMatch(options MatchOptions, filePath string) (*matchFullHash, bool) {
-	headHash.ensureMapExists(options)
-	hash, err := calculateFullHash(options, filePath)
+func (headHash *matchHeadHash) findFullMatch(options MatchOptions, statistics *stats.Stats, file *FileData) (*matchFullHash, bool) {
+	headHash.ensureMapExists(options, statistics)
+	hash, err := file.fullHash(options, statistics)
 	if err != nil {
 		return nil, false
 	}
-	actual, loaded := headHash.fullHashMap.LoadOrStore(hash, &matchFullHash{filePaths: []string{filePath}})
+	actual, loaded := headHash.fullHashMap.LoadOrStore(hash, &matchFullHash{hash: hash, files: []*FileData{file}})
 	return actual.(*matchFullHash), loaded
 }
 
-func (headHash *matchHeadHash) ensureMapExists(options MatchOptions) {
-	if headHash.singlePath != "" {
-		headHash.lock.Lock()
-		defer headHash.lock.Unlock()
-		if headHash.singlePath != "" {
-			hash, err := calculateFullHash(options, headHash.singlePath)
-			if err == nil {
-				headHash.fullHashMap.Store(hash, &matchFullHash{filePaths: []string{headHash.singlePath}})
-				headHash.singlePath = ""
-			}
+func (headHash *matchHeadHash) ensureMapExists(options MatchOptions, statistics *stats.Stats) {
+	headHash.lock.Lock()
+	defer headHash.lock.Unlock()
+	if headHash.singleFile != nil {
+		// a file that can't be hashed can't match anything, so it's dropped either way
+		hash, err := headHash.singleFile.fullHash(options, statistics)
+		if err == nil {
+			headHash.fullHashMap.Store(hash, &matchFullHash{hash: hash, files: []*FileData{headHash.singleFile}})
 		}
+		headHash.singleFile = nil
 	}
 }
@@ -2,6 +2,7 @@ package repo
 
 import (
 	"fmt"
+	"github.com/glxxyz/dedupe/stats"
 	"log"
 	"os"
 	"sync"
@@ -16,10 +17,16 @@ type MatchOptions interface {
 	Size() bool
 	Hash() bool
 	Contents() bool
+	Samples() []Sample
 	MinBytes() int64
 	SymLinks() bool
 	Verbose() bool
+	Throttle() *Throttle
+	Background() bool
+	Matchers() int
+	DeviceReaders(device uint64) int // zero when devices share the matchers rather than having readers of their own
 	Paths() []string
+	Scope() string
 }
 
 type primaryKey struct {
@@ -30,31 +37,101 @@ type primaryKey struct {
 
 type MatchRepository struct {
 	primaryMap sync.Map // primaryKey -> *matchAttributes
+	statistics *stats.Stats
 }
 
-func (matchRepo *MatchRepository) MatchFileToMove(options MatchOptions, file *FileData) (string, bool) {
-	if primary, found := matchRepo.findPrimaryMatch(file); found {
+func NewMatchRepository(statistics *stats.Stats) *MatchRepository {
+	return &MatchRepository{statistics: statistics}
+}
+
+// Add can be called concurrently, files are hashed as soon as they share attributes with another file
+func (matchRepo *MatchRepository) Add(options MatchOptions, file *FileData) {
+	if primary, found := matchRepo.findPrimaryMatch(options, file); found {
+		matchRepo.statistics.AttributesHit()
 		if options.Verbose() {
 			fmt.Printf("attributes match found for: %q\n", file.filePath)
 		}
-		if shortHash, found := primary.findHeadMatch(options, file.filePath); found {
+		if shortHash, found := primary.findHeadMatch(options, matchRepo.statistics, file); found {
+			matchRepo.statistics.HeadHashHit()
 			if options.Verbose() {
 				fmt.Printf("head hash match found for: %q\n", file.filePath)
 			}
-			if fullHash, found := shortHash.findFullMatch(options, file.filePath); found {
+			if fullHash, found := shortHash.findFullMatch(options, matchRepo.statistics, file); found {
+				matchRepo.statistics.FullHashHit()
 				if options.Verbose() {
 					fmt.Printf("full hash match found for: %q\n", file.filePath)
 				}
-				return fullHash.lowestPriorityMatch(options, file.filePath)
+				fullHash.add(file)
 			}
 		}
 	}
-	return "", false
 }
 
-func (matchRepo *MatchRepository) findPrimaryMatch(file *FileData) (*matchAttributes, bool) {
-	actual, loaded := matchRepo.primaryMap.LoadOrStore(
-		primaryKey{name: file.name, modTime: file.modTime, size: file.size},
-		&matchAttributes{singlePath: file.filePath})
+// Groups sends each set of duplicates to groups, it must only be called once all files have been added. Contents are
+// compared using the same number of goroutines as matching, or when devices have their own readers the candidates on
+// each set of devices are compared by their own goroutines, and no more than a device's readers read from it at once.
+func (matchRepo *MatchRepository) Groups(options MatchOptions, groups chan<- Group) {
+	queues := make(map[string][]*matchFullHash)
+	devices := make(map[string][]uint64)
+	matchRepo.primaryMap.Range(func(_, value interface{}) bool {
+		value.(*matchAttributes).forEachFullHash(func(fullHash *matchFullHash) {
+			if len(fullHash.files) > 1 {
+				on := fullHash.devices(options)
+				key := fmt.Sprint(on)
+				queues[key] = append(queues[key], fullHash)
+				devices[key] = on
+			}
+		})
+		return true
+	})
+	readers := make(map[uint64]chan struct{}) // a token for each of the device's readers
+	var verifiers sync.WaitGroup
+	for key, queue := range queues {
+		candidates := make(chan *matchFullHash, len(queue))
+		for _, fullHash := range queue {
+			candidates <- fullHash
+		}
+		close(candidates)
+		count := options.Matchers()
+		var tokens []chan struct{}
+		for i, device := range devices[key] {
+			limit := options.DeviceReaders(device)
+			if _, ok := readers[device]; !ok {
+				readers[device] = make(chan struct{}, limit)
+			}
+			tokens = append(tokens, readers[device])
+			if i == 0 || limit < count {
+				count = limit
+			}
+		}
+		for i := 0; i < count; i++ {
+			verifiers.Add(1)
+			go func() {
+				defer verifiers.Done()
+				for fullHash := range candidates {
+					// taken in the same order by every goroutine, so they can't deadlock
+					for _, token := range tokens {
+						token <- struct{}{}
+					}
+					found := fullHash.groups(options, matchRepo.statistics)
+					for _, token := range tokens {
+						<-token
+					}
+					for _, group := range found {
+						groups <- group
+					}
+				}
+			}()
+		}
+	}
+	verifiers.Wait()
+}
+
+func (matchRepo *MatchRepository) findPrimaryMatch(options MatchOptions, file *FileData) (*matchAttributes, bool) {
+	key := primaryKey{name: file.name, modTime: file.modTime}
+	if options.Size() {
+		key.size = file.size
+	}
+	actual, loaded := matchRepo.primaryMap.LoadOrStore(key, &matchAttributes{singleFile: file})
 	return actual.(*matchAttributes), loaded
 }
@@ -0,0 +1,72 @@
+package repo
+
+import (
+	"fmt"
+	"github.com/glxxyz/dedupe/stats"
+	"sync"
+)
+
+// matchSample is one stage of the chain of sampling hashes, files that share the hash of each stage move on to the
+// next one, and after the last stage to the head hash
+type matchSample struct {
+	lock       sync.Mutex
+	stage      int
+	singleFile *FileData
+	sampleMap  sync.Map // uint64 -> *matchSample
+	headMap    sync.Map // uint32 -> *matchHeadHash, once every stage has been used
+}
+
+func (sample *matchSample) findHeadMatch(options MatchOptions, statistics *stats.Stats, file *FileData) (*matchHeadHash, bool) {
+	sample.ensureMapExists(options, statistics)
+	return sample.find(options, statistics, file)
+}
+
+func (sample *matchSample) ensureMapExists(options MatchOptions, statistics *stats.Stats) {
+	sample.lock.Lock()
+	defer sample.lock.Unlock()
+	if sample.singleFile != nil {
+		statistics.SamplePassed(options.Samples()[sample.stage-1].String())
+		// a file that can't be hashed can't match anything, so it's dropped either way
+		sample.find(options, statistics, sample.singleFile)
+		sample.singleFile = nil
+	}
+}
+
+func (sample *matchSample) find(options MatchOptions, statistics *stats.Stats, file *FileData) (*matchHeadHash, bool) {
+	samples := options.Samples()
+	if sample.stage == len(samples) {
+		hash, err := file.headHash(options, statistics)
+		if err != nil {
+			return nil, false
+		}
+		actual, loaded := sample.headMap.LoadOrStore(hash, &matchHeadHash{singleFile: file})
+		return actual.(*matchHeadHash), loaded
+	}
+	hash, err := file.sampleHash(options, statistics, samples[sample.stage])
+	if err != nil {
+		return nil, false
+	}
+	actual, loaded := sample.sampleMap.LoadOrStore(hash, &matchSample{stage: sample.stage + 1, singleFile: file})
+	if !loaded {
+		return nil, false
+	}
+	statistics.SamplePassed(samples[sample.stage].String())
+	if options.Verbose() {
+		fmt.Printf("sample %v match found for: %q\n", samples[sample.stage], file.filePath)
+	}
+	return actual.(*matchSample).findHeadMatch(options, statistics, file)
+}
+
+func (sample *matchSample) forEachFullHash(f func(fullHash *matchFullHash)) {
+	sample.sampleMap.Range(func(_, value interface{}) bool {
+		value.(*matchSample).forEachFullHash(f)
+		return true
+	})
+	sample.headMap.Range(func(_, value interface{}) bool {
+		value.(*matchHeadHash).fullHashMap.Range(func(_, value interface{}) bool {
+			f(value.(*matchFullHash))
+			return true
+		})
+		return true
+	})
+}
@@ -0,0 +1,72 @@
+package repo
+
+import (
+	"bytes"
+	"github.com/glxxyz/dedupe/stats"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSamples(t *testing.T) {
+	header := bytes.Repeat([]byte{0}, 4096)
+	files := writeTestFiles(t, map[string][]byte{
+		"a": append(append([]byte{}, header...), "same tail"...),
+		"b": append(append([]byte{}, header...), "same tail"...),
+		"c": append(append([]byte{}, header...), "diff tail"...),
+	})
+	options := &testOptions{samples: []Sample{{Kind: SampleTail, Bytes: 16}, {Kind: SampleBlocks, Bytes: 8, Blocks: 2}}}
+	statistics := stats.New(nil)
+	matchRepo := NewMatchRepository(statistics)
+	for _, file := range files {
+		matchRepo.Add(options, file)
+	}
+	groups := make(chan Group, 10)
+	matchRepo.Groups(options, groups)
+	close(groups)
+	var got [][]string
+	for group := range groups {
+		var names []string
+		for _, file := range group.Files {
+			names = append(names, filepath.Base(file.filePath))
+		}
+		got = append(got, names)
+	}
+	if want := [][]string{{"a", "b"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Groups() = %v, want %v", got, want)
+	}
+
+	summary := statistics.Summary()
+	want := []stats.SampleStage{
+		{Name: "tail:16", Files: 3, Bytes: 48, Passed: 2, Eliminated: 1},
+		{Name: "blocks:2x8", Files: 2, Bytes: 32, Passed: 2, Eliminated: 0},
+	}
+	if !reflect.DeepEqual(summary.Samples, want) {
+		t.Errorf("Summary().Samples = %+v, want %+v", summary.Samples, want)
+	}
+	if summary.HeadHashes != 2 {
+		t.Errorf("Summary().HeadHashes = %d, want only the 2 files that passed every stage", summary.HeadHashes)
+	}
+}
+
+func TestSampleRanges(t *testing.T) {
+	tests := []struct {
+		name   string
+		sample Sample
+		size   int64
+		want   []sampleRange
+	}{
+		{"head", Sample{Kind: SampleHead, Bytes: 10}, 100, []sampleRange{{0, 10}}},
+		{"head of small file", Sample{Kind: SampleHead, Bytes: 10}, 4, []sampleRange{{0, 4}}},
+		{"tail", Sample{Kind: SampleTail, Bytes: 10}, 100, []sampleRange{{90, 10}}},
+		{"blocks", Sample{Kind: SampleBlocks, Bytes: 10, Blocks: 3}, 90, []sampleRange{{20, 10}, {40, 10}, {60, 10}}},
+		{"blocks cover file", Sample{Kind: SampleBlocks, Bytes: 10, Blocks: 3}, 30, []sampleRange{{0, 30}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.sample.ranges(tt.size); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ranges() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package repo
+
+import (
+	"fmt"
+	"github.com/glxxyz/dedupe/stats"
+)
+
+type SampleKind string
+
+// kinds of sampling stage
+const (
+	SampleHead   SampleKind = "head"
+	SampleTail   SampleKind = "tail"
+	SampleBlocks SampleKind = "blocks"
+)
+
+// Sample is one stage of the chain of cheap hashes that rule out candidates before the head and full hashes
+type Sample struct {
+	Kind   SampleKind
+	Bytes  int64 // read from the start or end, or in each block
+	Blocks int   // only used by SampleBlocks, spread evenly between the start and end
+}
+
+func (sample Sample) String() string {
+	if sample.Kind == SampleBlocks {
+		return fmt.Sprintf("%s:%dx%s", sample.Kind, sample.Blocks, stats.HumanReadableSize(sample.Bytes))
+	}
+	return fmt.Sprintf("%s:%s", sample.Kind, stats.HumanReadableSize(sample.Bytes))
+}
+
+type sampleRange struct {
+	offset int64
+	length int64
+}
+
+// ranges to read from a file of the given size, every file at the same stage has the same size
+func (sample Sample) ranges(size int64) []sampleRange {
+	length := sample.Bytes
+	if length > size {
+		length = size
+	}
+	switch sample.Kind {
+	case SampleHead:
+		return []sampleRange{{0, length}}
+	case SampleTail:
+		return []sampleRange{{size - length, length}}
+	}
+	if int64(sample.Blocks)*sample.Bytes >= size {
+		return []sampleRange{{0, size}}
+	}
+	ranges := make([]sampleRange, sample.Blocks)
+	step := (size - sample.Bytes) / int64(sample.Blocks+1)
+	for i := range ranges {
+		ranges[i] = sampleRange{step * int64(i+1), sample.Bytes}
+	}
+	return ranges
+}
@@ -0,0 +1,92 @@
+package repo
+
+import (
+	"bytes"
+	"github.com/glxxyz/dedupe/stats"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// the kinds of file SniffType recognises
+const (
+	TypeImage    = "image"
+	TypeVideo    = "video"
+	TypeAudio    = "audio"
+	TypeDocument = "document"
+)
+
+// sniffBytes is as much as http.DetectContentType looks at
+const sniffBytes = 512
+
+// the ISO base media brands that http.DetectContentType doesn't know, which covers HEIC photos and QuickTime movies
+var ftypBrands = map[string]string{
+	"heic": TypeImage, "heix": TypeImage, "heim": TypeImage, "heis": TypeImage, "mif1": TypeImage, "msf1": TypeImage,
+	"avif": TypeImage, "avis": TypeImage, "crx ": TypeImage,
+	"qt  ": TypeVideo, "isom": TypeVideo, "iso2": TypeVideo, "mp41": TypeVideo, "mp42": TypeVideo, "M4V ": TypeVideo,
+	"3gp4": TypeVideo, "3gp5": TypeVideo, "3g2a": TypeVideo,
+	"M4A ": TypeAudio, "M4B ": TypeAudio,
+}
+
+// SniffType reads the start of a file to tell what kind it is from its contents rather than its name, returning ""
+// when it's none of them. Plain text isn't a document, as it could just as well be source code, a log or a CSV file.
+func SniffType(options ReadOptions, statistics *stats.Stats, path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		errLog.Printf("unable to open file: %v\n", err)
+		statistics.Error(stats.ErrorOpen)
+		return "", err
+	}
+	defer file.Close()
+	head := make([]byte, sniffBytes)
+	count, err := io.ReadFull(file, head)
+	options.Throttle().wait(statistics, count)
+	if options.Background() {
+		dropCache(file)
+	}
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		errLog.Printf("error reading from file: %v\n", err)
+		statistics.Error(stats.ErrorRead)
+		return "", err
+	}
+	return sniffType(head[:count]), nil
+}
+
+func sniffType(head []byte) string {
+	if len(head) == 0 {
+		// DetectContentType calls nothing text
+		return ""
+	}
+	if len(head) >= 12 && string(head[4:8]) == "ftyp" {
+		if kind, ok := ftypBrands[string(head[8:12])]; ok {
+			return kind
+		}
+	}
+	switch {
+	case bytes.HasPrefix(head, []byte("\xD0\xCF\x11\xE0\xA1\xB1\x1A\xE1")):
+		// the old Office formats
+		return TypeDocument
+	case bytes.HasPrefix(head, []byte("{\\rtf")):
+		// DetectContentType calls this plain text
+		return TypeDocument
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")):
+		// Office Open XML and OpenDocument are zips that start with these
+		if bytes.Contains(head, []byte("[Content_Types].xml")) || bytes.Contains(head, []byte("mimetypeapplication/vnd.oasis")) {
+			return TypeDocument
+		}
+		return ""
+	}
+	contentType := http.DetectContentType(head)
+	switch {
+	case strings.HasPrefix(contentType, "image/"):
+		return TypeImage
+	case strings.HasPrefix(contentType, "video/"):
+		return TypeVideo
+	case strings.HasPrefix(contentType, "audio/"), strings.HasPrefix(contentType, "application/ogg"):
+		return TypeAudio
+	case strings.HasPrefix(contentType, "application/pdf"), strings.HasPrefix(contentType, "application/postscript"):
+		return TypeDocument
+	}
+	return ""
+}
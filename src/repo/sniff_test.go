@@ -0,0 +1,52 @@
+package repo
+
+import (
+	"github.com/glxxyz/dedupe/stats"
+	"testing"
+)
+
+func Test_sniffType(t *testing.T) {
+	tests := []struct {
+		name string
+		head string
+		want string
+	}{
+		{"jpeg", "\xFF\xD8\xFF\xE0\x00\x10JFIF\x00", TypeImage},
+		{"png", "\x89PNG\x0D\x0A\x1A\x0A\x00\x00\x00\x0DIHDR", TypeImage},
+		{"heic", "\x00\x00\x00\x18ftypheic\x00\x00\x00\x00mif1heic", TypeImage},
+		{"mov", "\x00\x00\x00\x14ftypqt  \x00\x00\x00\x00qt  ", TypeVideo},
+		{"mp4", "\x00\x00\x00\x18ftypmp42\x00\x00\x00\x00mp42isom", TypeVideo},
+		{"m4a", "\x00\x00\x00\x1CftypM4A \x00\x00\x00\x00M4A mp42", TypeAudio},
+		{"mp3", "ID3\x03\x00\x00\x00\x00\x00\x00", TypeAudio},
+		{"pdf", "%PDF-1.7\n", TypeDocument},
+		{"rtf", "{\\rtf1\\ansi some notes}", TypeDocument},
+		{"text", "some notes\n", ""},
+		{"csv", "name,size\nphoto.jpg,100\n", ""},
+		{"html", "<!DOCTYPE html><html></html>", ""},
+		{"docx", "PK\x03\x04\x14\x00\x06\x00\x08\x00\x00\x00!\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x13\x00\x00\x00[Content_Types].xml", TypeDocument},
+		{"zip", "PK\x03\x04\x14\x00\x00\x00\x08\x00photos/a.jpg", ""},
+		{"binary", "\x00\x01\x02\x03\x04\x05", ""},
+		{"empty", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sniffType([]byte(tt.head)); got != tt.want {
+				t.Errorf("sniffType() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSniffType(t *testing.T) {
+	files := writeTestFiles(t, map[string][]byte{"photo": []byte("\xFF\xD8\xFF\xE0 photo")})
+	statistics := stats.New(nil)
+	if got, err := SniffType(&testOptions{}, statistics, files[0].filePath); err != nil || got != TypeImage {
+		t.Errorf("SniffType() = %q, %v, want %q", got, err, TypeImage)
+	}
+	if _, err := SniffType(&testOptions{}, statistics, files[0].filePath+".missing"); err == nil {
+		t.Error("SniffType() of a missing file succeeded, want an error")
+	}
+	if errors := statistics.Summary().Errors[stats.ErrorOpen]; errors != 1 {
+		t.Errorf("open errors = %d, want 1 for the missing file", errors)
+	}
+}
@@ -0,0 +1,68 @@
+package repo
+
+import (
+	"github.com/glxxyz/dedupe/stats"
+	"sync"
+	"time"
+)
+
+// Throttle is a token bucket shared by every read, so its limits apply across the whole scan. Up to a second's worth
+// of reads can be made in a burst. All methods are safe to call on a nil *Throttle, which doesn't limit anything.
+type Throttle struct {
+	lock  sync.Mutex
+	bytes bucket
+	ops   bucket
+}
+
+type bucket struct {
+	rate   float64 // per second, zero is unlimited
+	tokens float64
+	last   time.Time
+}
+
+// NewThrottle returns nil when neither limit is set
+func NewThrottle(bytesPerSecond int64, opsPerSecond int64) *Throttle {
+	if bytesPerSecond <= 0 && opsPerSecond <= 0 {
+		return nil
+	}
+	now := time.Now()
+	return &Throttle{
+		bytes: bucket{rate: float64(bytesPerSecond), tokens: float64(bytesPerSecond), last: now},
+		ops:   bucket{rate: float64(opsPerSecond), tokens: float64(opsPerSecond), last: now},
+	}
+}
+
+// wait is called after each read with the bytes read, and sleeps until the reads so far are within the limits
+func (throttle *Throttle) wait(statistics *stats.Stats, bytes int) {
+	if throttle == nil {
+		return
+	}
+	throttle.lock.Lock()
+	now := time.Now()
+	delay := throttle.bytes.reserve(float64(bytes), now)
+	if opsDelay := throttle.ops.reserve(1, now); opsDelay > delay {
+		delay = opsDelay
+	}
+	throttle.lock.Unlock()
+	if delay > 0 {
+		statistics.Throttled(delay)
+		time.Sleep(delay)
+	}
+}
+
+// reserve takes n tokens, going into debt if there aren't enough, and returns how long until the debt is paid off
+func (b *bucket) reserve(n float64, now time.Time) time.Duration {
+	if b.rate <= 0 {
+		return 0
+	}
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.rate {
+		b.tokens = b.rate
+	}
+	b.last = now
+	b.tokens -= n
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
@@ -0,0 +1,32 @@
+package repo
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_bucketReserve(t *testing.T) {
+	start := time.Now()
+	b := bucket{rate: 1000, tokens: 1000, last: start}
+	steps := []struct {
+		name  string
+		after time.Duration
+		n     float64
+		want  time.Duration
+	}{
+		{"burst of a second", 0, 1000, 0},
+		{"into debt", 0, 500, 500 * time.Millisecond},
+		{"debt paid off", 500 * time.Millisecond, 100, 100 * time.Millisecond},
+		{"refilled", 2 * time.Second, 1000, 0},
+	}
+	for _, step := range steps {
+		if got := b.reserve(step.n, start.Add(step.after)); got != step.want {
+			t.Errorf("%s: reserve() = %v, want %v", step.name, got, step.want)
+		}
+	}
+	if NewThrottle(0, 0) != nil {
+		t.Error("NewThrottle() without limits isn't nil")
+	}
+	var unlimited *Throttle
+	unlimited.wait(nil, 1<<30)
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/glxxyz/dedupe/dedupe"
+	"github.com/glxxyz/dedupe/stats"
+	"io"
+	"os"
+	"sync"
+)
+
+type ReportOptions interface {
+	Format() string
+	Output() string
+}
+
+// reportGroup is a line of a JSON report, which is what verify and apply read back
+type reportGroup struct {
+	Size       int64    `json:"size"`
+	Hash       string   `json:"hash,omitempty"`
+	Keep       string   `json:"keep"`
+	Duplicates []string `json:"duplicates"`
+}
+
+// reportAction writes each group of duplicates to the report instead of moving them
+type reportAction struct {
+	options ReportOptions
+	lock    sync.Mutex
+	writer  io.Writer
+	file    *os.File
+	err     error
+}
+
+func newReportAction(options ReportOptions) (*reportAction, error) {
+	action := &reportAction{options: options, writer: os.Stdout}
+	if options.Output() != "" {
+		file, err := os.Create(options.Output())
+		if err != nil {
+			return nil, fmt.Errorf("failed to create report: %w", err)
+		}
+		action.file = file
+		action.writer = file
+	}
+	return action, nil
+}
+
+func newReportGroup(group dedupe.Group) reportGroup {
+	report := reportGroup{Size: group.Keep().Size(), Keep: group.Keep().Path()}
+	if group.Hash != 0 {
+		report.Hash = fmt.Sprintf("%016x", group.Hash)
+	}
+	for _, file := range group.Duplicates() {
+		report.Duplicates = append(report.Duplicates, file.Path())
+	}
+	return report
+}
+
+func (action *reportAction) Apply(group dedupe.Group) {
+	report := newReportGroup(group)
+	var buffer bytes.Buffer
+	if action.options.Format() == "json" {
+		line, _ := json.Marshal(report)
+		buffer.Write(append(line, '\n'))
+	} else {
+		fmt.Fprintf(&buffer, "# %d files of %s", len(group.Files), stats.HumanReadableSize(report.Size))
+		if report.Hash != "" {
+			fmt.Fprintf(&buffer, ", hash %s", report.Hash)
+		}
+		fmt.Fprintf(&buffer, "\nkeep\t%s\n", report.Keep)
+		for _, path := range report.Duplicates {
+			fmt.Fprintf(&buffer, "dupe\t%s\n", path)
+		}
+	}
+	action.lock.Lock()
+	defer action.lock.Unlock()
+	if _, err := action.writer.Write(buffer.Bytes()); err != nil && action.err == nil {
+		action.err = err
+	}
+}
+
+// close returns the first error writing the report
+func (action *reportAction) close() error {
+	if action.file != nil {
+		if err := action.file.Close(); err != nil && action.err == nil {
+			action.err = err
+		}
+	}
+	if action.err != nil {
+		return fmt.Errorf("failed to write report: %w", action.err)
+	}
+	return nil
+}
+
+func readReport(path string) ([]reportGroup, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open report: %w", err)
+	}
+	defer file.Close()
+	var groups []reportGroup
+	decoder := json.NewDecoder(file)
+	for {
+		var group reportGroup
+		if err := decoder.Decode(&group); err == io.EOF {
+			return groups, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to read report %q, it must be written with --format=json: %w", path, err)
+		}
+		groups = append(groups, group)
+	}
+}
+
+// staleReason says why a duplicate in a report can't be trusted any more, or returns "" if it still can
+func staleReason(group reportGroup, duplicate string) string {
+	keep, err := os.Lstat(group.Keep)
+	if err != nil {
+		return "kept file is gone"
+	}
+	dupe, err := os.Lstat(duplicate)
+	if err != nil {
+		return "duplicate is gone"
+	}
+	if !keep.Mode().IsRegular() || !dupe.Mode().IsRegular() {
+		return "not a regular file"
+	}
+	if keep.Size() != group.Size || dupe.Size() != group.Size {
+		return "size changed"
+	}
+	same, err := sameContents(group.Keep, duplicate)
+	if err != nil {
+		errLog.Printf("error comparing files: %v\n", err)
+		return "couldn't be read"
+	}
+	if !same {
+		return "contents changed"
+	}
+	return ""
+}
+
+func sameContents(a string, b string) (bool, error) {
+	fileA, err := os.Open(a)
+	if err != nil {
+		return false, err
+	}
+	defer fileA.Close()
+	fileB, err := os.Open(b)
+	if err != nil {
+		return false, err
+	}
+	defer fileB.Close()
+	blockA := make([]byte, 64*1024)
+	blockB := make([]byte, len(blockA))
+	for {
+		countA, errA := io.ReadFull(fileA, blockA)
+		countB, errB := io.ReadFull(fileB, blockB)
+		if !bytes.Equal(blockA[:countA], blockB[:countB]) {
+			return false, nil
+		}
+		endA := errA == io.EOF || errA == io.ErrUnexpectedEOF
+		endB := errB == io.EOF || errB == io.ErrUnexpectedEOF
+		if errA != nil && !endA {
+			return false, errA
+		} else if errB != nil && !endB {
+			return false, errB
+		} else if endA || endB {
+			return endA && endB, nil
+		}
+	}
+}
+
+type VerifyOptions interface {
+	Report() string
+	Verbose() bool
+}
+
+func verifyReport(options VerifyOptions) error {
+	groups, err := readReport(options.Report())
+	if err != nil {
+		return err
+	}
+	var duplicates, stale int
+	for _, group := range groups {
+		for _, duplicate := range group.Duplicates {
+			duplicates++
+			if reason := staleReason(group, duplicate); reason != "" {
+				stale++
+				fmt.Printf("Stale:\t%v\t%v\n", duplicate, reason)
+			} else if options.Verbose() {
+				fmt.Printf("Verified:\t%v\n", duplicate)
+			}
+		}
+	}
+	if stale > 0 {
+		return fmt.Errorf("%d of %d duplicates in the report are stale", stale, duplicates)
+	}
+	fmt.Fprintf(os.Stderr, "all %d duplicates in the report verified\n", duplicates)
+	return nil
+}
+
+type ApplyOptions interface {
+	MoveOptions
+	HookOptions
+	ReadOptions
+	Report() string
+}
+
+// applyReport moves the duplicates in a report to the trash, checking each one first
+func applyReport(options ApplyOptions) error {
+	groups, err := readReport(options.Report())
+	if err != nil {
+		return err
+	}
+	statistics := stats.New(nil)
+	hooks := newHooks(options, statistics)
+	useBackground(options.Background(), options.Verbose())
+	reader := newFileReader(options)
+	skipped := 0
+	for _, group := range groups {
+		for _, duplicate := range group.Duplicates {
+			if reason := staleReason(group, duplicate); reason != "" {
+				skipped++
+				fmt.Printf("Skip:\t%v\t%v\n", duplicate, reason)
+				continue
+			}
+			if !hooks.move(group, duplicate) {
+				skipped++
+				vetoed(duplicate, "on-move")
+				continue
+			}
+			Move(options, reader, statistics, group.Keep, duplicate)
+		}
+	}
+	summary := statistics.Summary()
+	fmt.Fprintf(os.Stderr, "moved %d files %s to trash, skipped %d\n",
+		summary.FilesMoved, stats.HumanReadableSize(summary.BytesReclaimed), skipped)
+	if len(summary.Errors) > 0 {
+		return fmt.Errorf("failed to move some files: %v", summary.Errors)
+	}
+	return nil
+}
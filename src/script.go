@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/glxxyz/dedupe/dedupe"
+	"github.com/glxxyz/dedupe/param"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+type ScriptOptions interface {
+	MoveOptions
+	EmitScript() string
+}
+
+// scriptAction writes a script that moves each group's duplicates to the trash, instead of moving them. Each move is
+// skipped if the file's gone or something's in its place in the trash, so the script can be run again.
+type scriptAction struct {
+	options ScriptOptions
+	journal string
+	lock    sync.Mutex
+	writer  io.Writer
+	claimed map[string]bool // destinations earlier in the script, as they aren't in the trash yet
+	err     error
+}
+
+func newScriptAction(options ScriptOptions, writer io.Writer) (*scriptAction, error) {
+	journal, err := journalPath(options.Trash())
+	if err != nil {
+		return nil, err
+	}
+	action := &scriptAction{options: options, journal: journal, writer: writer, claimed: make(map[string]bool)}
+	var buffer bytes.Buffer
+	if options.EmitScript() == "ps1" {
+		fmt.Fprintf(&buffer, "# moves duplicates to the trash at %q, written by dedupe at %s\n",
+			options.Trash(), runStarted.Format("2006-01-02 15:04:05"))
+		buffer.WriteString("$ErrorActionPreference = 'Stop'\n")
+		fmt.Fprintf(&buffer, "[void][System.IO.Directory]::CreateDirectory(%s)\n", quotePowerShell(filepath.Dir(journal)))
+	} else {
+		buffer.WriteString("#!/bin/sh\n")
+		fmt.Fprintf(&buffer, "# moves duplicates to the trash at %q, written by dedupe at %s\n",
+			options.Trash(), runStarted.Format("2006-01-02 15:04:05"))
+		buffer.WriteString("set -e\n")
+		fmt.Fprintf(&buffer, "mkdir -p -- %s\n", quoteShell(filepath.Dir(journal)))
+	}
+	action.write(buffer.Bytes())
+	return action, nil
+}
+
+func (action *scriptAction) Apply(group dedupe.Group) {
+	keep := group.Keep().Path()
+	var buffer bytes.Buffer
+	// %q keeps a newline in a name from ending the comment
+	fmt.Fprintf(&buffer, "\n# keep %q", keep)
+	if group.Hash != 0 {
+		fmt.Fprintf(&buffer, ", hash %016x", group.Hash)
+	}
+	buffer.WriteString("\n")
+	action.lock.Lock()
+	defer action.lock.Unlock()
+	for _, file := range group.Duplicates() {
+		destPath := action.destination(keep, file.Path())
+		if destPath == "" {
+			fmt.Fprintf(&buffer, "# not moving %q, there's already a file in the trash where it would go\n", file.Path())
+			continue
+		}
+		entry, _ := json.Marshal(journalEntry{
+			Run:      runStarted,
+			Time:     time.Now(),
+			Original: file.Path(),
+			Trashed:  destPath,
+			Layout:   action.options.TrashLayout(),
+			Keep:     keep,
+			Size:     file.Size(),
+		})
+		if action.options.EmitScript() == "ps1" {
+			writePowerShellMove(&buffer, file.Path(), destPath, action.journal, string(entry))
+		} else {
+			writeShellMove(&buffer, file.Path(), destPath, action.journal, string(entry))
+		}
+	}
+	action.write(buffer.Bytes())
+}
+
+// destination is where the layout puts a file, applying the suffix policy to what's in the trash and earlier in the
+// script, or "" when it's taken and the policy is skip, the only other one a script can follow
+func (action *scriptAction) destination(keep string, filePath string) string {
+	destPath := layoutPath(action.options, keep, filePath)
+	taken := func(path string) bool {
+		return action.claimed[path] || inTrash(path)
+	}
+	if taken(destPath) && action.options.Collision() != param.CollisionSuffix {
+		return ""
+	}
+	destPath = unusedName(destPath, taken)
+	action.claimed[destPath] = true
+	return destPath
+}
+
+func writeShellMove(w io.Writer, filePath string, destPath string, journal string, entry string) {
+	fmt.Fprintf(w, "if [ -e %s ] && [ ! -e %s ]; then\n", quoteShell(filePath), quoteShell(destPath))
+	fmt.Fprintf(w, "\tmkdir -p -- %s\n", quoteShell(filepath.Dir(destPath)))
+	fmt.Fprintf(w, "\tmv -- %s %s\n", quoteShell(filePath), quoteShell(destPath))
+	fmt.Fprintf(w, "\tprintf '%%s\\n' %s >> %s\n", quoteShell(entry), quoteShell(journal))
+	fmt.Fprintf(w, "fi\n")
+}
+
+// writePowerShellMove uses .NET rather than cmdlets, as they don't treat [ and ] in names as wildcards
+func writePowerShellMove(w io.Writer, filePath string, destPath string, journal string, entry string) {
+	fmt.Fprintf(w, "if ((Test-Path -LiteralPath %s) -and -not (Test-Path -LiteralPath %s)) {\n",
+		quotePowerShell(filePath), quotePowerShell(destPath))
+	fmt.Fprintf(w, "    [void][System.IO.Directory]::CreateDirectory(%s)\n", quotePowerShell(filepath.Dir(destPath)))
+	fmt.Fprintf(w, "    [System.IO.File]::Move(%s, %s)\n", quotePowerShell(filePath), quotePowerShell(destPath))
+	fmt.Fprintf(w, "    [System.IO.File]::AppendAllText(%s, %s + \"`n\")\n", quotePowerShell(journal), quotePowerShell(entry))
+	fmt.Fprintf(w, "}\n")
+}
+
+// quoteShell single quotes a string, nothing is special inside them apart from the ' itself
+func quoteShell(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// quotePowerShell single quotes a string, where a quote is escaped by doubling it, and PowerShell also takes the
+// typographic single quotes as quotes
+func quotePowerShell(s string) string {
+	var quoted strings.Builder
+	quoted.WriteString("'")
+	for _, r := range s {
+		switch r {
+		case '\'', '‘', '’', '‚', '‛':
+			quoted.WriteRune(r)
+		}
+		quoted.WriteRune(r)
+	}
+	quoted.WriteString("'")
+	return quoted.String()
+}
+
+func (action *scriptAction) write(script []byte) {
+	if _, err := action.writer.Write(script); err != nil && action.err == nil {
+		action.err = err
+	}
+}
+
+// close returns the first error writing the script
+func (action *scriptAction) close() error {
+	if action.err != nil {
+		return fmt.Errorf("failed to write script: %w", action.err)
+	}
+	return nil
+}
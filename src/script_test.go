@@ -0,0 +1,48 @@
+package main
+
+import (
+	"os/exec"
+	"testing"
+)
+
+func Test_quoteShell(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("no sh to run the quoted strings with")
+	}
+	for _, s := range []string{
+		"",
+		"plain.txt",
+		"-n leading dash",
+		"$HOME and $(date) and `date`",
+		`it's "quoted" \ back`,
+		"new\nline",
+		"*.jpg ? [ab] ~ ! # ; & | < >",
+		"ünïcödé ‘curly’",
+	} {
+		got, err := exec.Command(sh, "-c", "printf '%s' "+quoteShell(s)).Output()
+		if err != nil {
+			t.Errorf("sh failed for %q: %v", s, err)
+		} else if string(got) != s {
+			t.Errorf("quoteShell(%q) = %s, sh printed %q", s, quoteShell(s), got)
+		}
+	}
+}
+
+func Test_quotePowerShell(t *testing.T) {
+	tests := []struct {
+		s    string
+		want string
+	}{
+		{"plain.txt", "'plain.txt'"},
+		{"$env:HOME `n", "'$env:HOME `n'"},
+		{"it's", "'it''s'"},
+		{"‘curly’ ‚low‛", "'‘‘curly’’ ‚‚low‛‛'"},
+		{`"double"`, `'"double"'`},
+	}
+	for _, tt := range tests {
+		if got := quotePowerShell(tt.s); got != tt.want {
+			t.Errorf("quotePowerShell(%q) = %s, want %s", tt.s, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,3 @@
+module github.com/glxxyz/dedupe/stats
+
+go 1.14
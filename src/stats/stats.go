@@ -0,0 +1,345 @@
+package stats
+
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// stage names used for timing
+const (
+	Scan  = "scan"
+	Match = "match"
+	Move  = "move"
+)
+
+// error kinds
+const (
+	ErrorWalk       = "walk"
+	ErrorSymLink    = "symlink"
+	ErrorOpen       = "open"
+	ErrorRead       = "read"
+	ErrorMkdir      = "mkdir"
+	ErrorMove       = "move"
+	ErrorSpill      = "spill"
+	ErrorCheckpoint = "checkpoint"
+	ErrorJournal    = "journal"
+	ErrorCollision  = "collision"
+	ErrorHook       = "hook"
+)
+
+// Stats is collected concurrently from the scanner, matcher and mover stages, all methods are safe to call on a nil *Stats
+type Stats struct {
+	// accessed atomically, kept first for 64-bit alignment
+	filesScanned    int64
+	bytesScanned    int64
+	sampledBytes    int64
+	headHashes      int64
+	headHashedBytes int64
+	fullHashes      int64
+	fullHashedBytes int64
+	cachedHashes    int64
+	throttledNanos  int64
+	candidateBytes  int64
+	comparedBytes   int64
+	attributeHits   int64
+	headHashHits    int64
+	fullHashHits    int64
+	duplicateGroups int64
+	duplicates      int64
+	duplicateBytes  int64
+	filesMoved      int64
+	bytesReclaimed  int64
+
+	roots   []string
+	started time.Time
+
+	lock        sync.Mutex
+	errors      map[string]int64
+	stages      map[string]*stage
+	byRoot      map[string]*Breakdown
+	byExtension map[string]*Breakdown
+	samples     map[string]*SampleStage
+	sampleOrder []string
+}
+
+type stage struct {
+	started  time.Time
+	finished time.Time
+}
+
+func New(roots []string) *Stats {
+	return &Stats{
+		roots:       roots,
+		started:     time.Now(),
+		errors:      make(map[string]int64),
+		stages:      make(map[string]*stage),
+		byRoot:      make(map[string]*Breakdown),
+		byExtension: make(map[string]*Breakdown),
+		samples:     make(map[string]*SampleStage),
+	}
+}
+
+func (stats *Stats) StageStarted(name string) {
+	if stats == nil {
+		return
+	}
+	stats.lock.Lock()
+	defer stats.lock.Unlock()
+	stats.stages[name] = &stage{started: time.Now()}
+}
+
+func (stats *Stats) StageFinished(name string) {
+	if stats == nil {
+		return
+	}
+	stats.lock.Lock()
+	defer stats.lock.Unlock()
+	if s, ok := stats.stages[name]; ok {
+		s.finished = time.Now()
+	}
+}
+
+func (stats *Stats) FileScanned(path string, size int64) {
+	if stats == nil {
+		return
+	}
+	atomic.AddInt64(&stats.filesScanned, 1)
+	atomic.AddInt64(&stats.bytesScanned, size)
+	stats.breakdown(path, func(b *Breakdown) {
+		b.Files++
+		b.Bytes += size
+	})
+}
+
+// SampleHashed is called each time a sampling stage hashes a file
+func (stats *Stats) SampleHashed(stage string, bytes int64) {
+	if stats == nil {
+		return
+	}
+	atomic.AddInt64(&stats.sampledBytes, bytes)
+	stats.sample(stage, func(s *SampleStage) {
+		s.Files++
+		s.Bytes += bytes
+	})
+}
+
+// SamplePassed is called for each file that shares a sample hash with another, so moves on to the next stage
+func (stats *Stats) SamplePassed(stage string) {
+	if stats == nil {
+		return
+	}
+	stats.sample(stage, func(s *SampleStage) {
+		s.Passed++
+	})
+}
+
+func (stats *Stats) HeadHashed(bytes int64) {
+	if stats == nil {
+		return
+	}
+	atomic.AddInt64(&stats.headHashes, 1)
+	atomic.AddInt64(&stats.headHashedBytes, bytes)
+}
+
+func (stats *Stats) FullHashed(bytes int64) {
+	if stats == nil {
+		return
+	}
+	atomic.AddInt64(&stats.fullHashes, 1)
+	atomic.AddInt64(&stats.fullHashedBytes, bytes)
+}
+
+// HashCached is called when a hash that was already calculated for a file is needed again
+func (stats *Stats) HashCached() {
+	if stats == nil {
+		return
+	}
+	atomic.AddInt64(&stats.cachedHashes, 1)
+}
+
+// Throttled is called each time a read has to wait for the I/O limits
+func (stats *Stats) Throttled(delay time.Duration) {
+	if stats == nil {
+		return
+	}
+	atomic.AddInt64(&stats.throttledNanos, int64(delay))
+}
+
+// Compared is called with the bytes read from each file when comparing whole contents
+func (stats *Stats) Compared(bytes int64) {
+	if stats == nil {
+		return
+	}
+	atomic.AddInt64(&stats.comparedBytes, bytes)
+}
+
+// AttributesHit is called when a file's attributes match an earlier file
+func (stats *Stats) AttributesHit() {
+	if stats == nil {
+		return
+	}
+	atomic.AddInt64(&stats.attributeHits, 1)
+}
+
+// HeadHashHit is called when a file's head hash matches an earlier file
+func (stats *Stats) HeadHashHit() {
+	if stats == nil {
+		return
+	}
+	atomic.AddInt64(&stats.headHashHits, 1)
+}
+
+// FullHashHit is called when a file's full hash matches an earlier file
+func (stats *Stats) FullHashHit() {
+	if stats == nil {
+		return
+	}
+	atomic.AddInt64(&stats.fullHashHits, 1)
+}
+
+// Candidate is called for each file that shares attributes with another, so will probably need to be hashed
+func (stats *Stats) Candidate(size int64) {
+	if stats == nil {
+		return
+	}
+	atomic.AddInt64(&stats.candidateBytes, size)
+}
+
+// DuplicateGroup is called once for each set of identical files, when the first duplicate is found
+func (stats *Stats) DuplicateGroup() {
+	if stats == nil {
+		return
+	}
+	atomic.AddInt64(&stats.duplicateGroups, 1)
+}
+
+// Duplicate is called for each lower priority file, the one that would be moved
+func (stats *Stats) Duplicate(path string, size int64) {
+	if stats == nil {
+		return
+	}
+	atomic.AddInt64(&stats.duplicates, 1)
+	atomic.AddInt64(&stats.duplicateBytes, size)
+	stats.breakdown(path, func(b *Breakdown) {
+		b.Duplicates++
+		b.DuplicateBytes += size
+	})
+}
+
+// Moved is called for each file successfully moved to the trash
+func (stats *Stats) Moved(path string, size int64) {
+	if stats == nil {
+		return
+	}
+	atomic.AddInt64(&stats.filesMoved, 1)
+	atomic.AddInt64(&stats.bytesReclaimed, size)
+	stats.breakdown(path, func(b *Breakdown) {
+		b.Moved++
+		b.BytesReclaimed += size
+	})
+}
+
+func (stats *Stats) Error(kind string) {
+	if stats == nil {
+		return
+	}
+	stats.lock.Lock()
+	defer stats.lock.Unlock()
+	stats.errors[kind]++
+}
+
+// Progress is a cheaper snapshot than Summary, for frequent updates while the stages are running
+type Progress struct {
+	FilesScanned    int64
+	BytesScanned    int64
+	FullHashes      int64
+	HashedBytes     int64 // sample, head and full hashes, and compared contents
+	FullHashedBytes int64
+	ComparedBytes   int64
+	CandidateBytes  int64
+	Duplicates      int64
+	FilesMoved      int64
+	ScanFinished    bool
+	Elapsed         time.Duration
+}
+
+func (stats *Stats) Progress() Progress {
+	if stats == nil {
+		return Progress{}
+	}
+	progress := Progress{
+		FilesScanned:    atomic.LoadInt64(&stats.filesScanned),
+		BytesScanned:    atomic.LoadInt64(&stats.bytesScanned),
+		FullHashes:      atomic.LoadInt64(&stats.fullHashes),
+		HashedBytes:     atomic.LoadInt64(&stats.sampledBytes) + atomic.LoadInt64(&stats.headHashedBytes) + atomic.LoadInt64(&stats.fullHashedBytes) + atomic.LoadInt64(&stats.comparedBytes),
+		FullHashedBytes: atomic.LoadInt64(&stats.fullHashedBytes),
+		ComparedBytes:   atomic.LoadInt64(&stats.comparedBytes),
+		CandidateBytes:  atomic.LoadInt64(&stats.candidateBytes),
+		Duplicates:      atomic.LoadInt64(&stats.duplicates),
+		FilesMoved:      atomic.LoadInt64(&stats.filesMoved),
+		Elapsed:         time.Since(stats.started),
+	}
+	stats.lock.Lock()
+	defer stats.lock.Unlock()
+	if s, ok := stats.stages[Scan]; ok {
+		progress.ScanFinished = !s.finished.IsZero()
+	}
+	return progress
+}
+
+func (stats *Stats) breakdown(path string, update func(b *Breakdown)) {
+	root := stats.rootOf(path)
+	extension := extensionOf(path)
+	stats.lock.Lock()
+	defer stats.lock.Unlock()
+	update(lookup(stats.byRoot, root))
+	update(lookup(stats.byExtension, extension))
+}
+
+// sample keeps the stages in the order they're first used, which is the order of the chain
+func (stats *Stats) sample(stage string, update func(s *SampleStage)) {
+	stats.lock.Lock()
+	defer stats.lock.Unlock()
+	s, ok := stats.samples[stage]
+	if !ok {
+		s = &SampleStage{Name: stage}
+		stats.samples[stage] = s
+		stats.sampleOrder = append(stats.sampleOrder, stage)
+	}
+	update(s)
+}
+
+func lookup(breakdowns map[string]*Breakdown, name string) *Breakdown {
+	b, ok := breakdowns[name]
+	if !ok {
+		b = &Breakdown{Name: name}
+		breakdowns[name] = b
+	}
+	return b
+}
+
+// rootOf finds the highest priority root containing path, the same way files are prioritized when matching
+func (stats *Stats) rootOf(path string) string {
+	for _, root := range stats.roots {
+		if strings.Index(path, root) == 0 {
+			return root
+		}
+	}
+	return OtherRoot
+}
+
+// OtherRoot is used for files outside of all roots, reached by following symbolic links
+const OtherRoot = "(other)"
+
+// NoExtension is used for files without an extension
+const NoExtension = "(none)"
+
+func extensionOf(path string) string {
+	if extension := strings.ToLower(filepath.Ext(path)); extension != "" {
+		return extension
+	}
+	return NoExtension
+}
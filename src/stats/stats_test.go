@@ -0,0 +1,75 @@
+package stats
+
+import "testing"
+
+func TestHumanReadableSize(t *testing.T) {
+	tests := []struct {
+		bytes int64
+		want  string
+	}{
+		{0, "0"},
+		{1023, "1023"},
+		{1024, "1.0K"},
+		{1536, "1.5K"},
+		{1024 * 1024, "1.0M"},
+		{5 * 1024 * 1024 * 1024, "5.0G"},
+		{-2048, "-2.0K"},
+	}
+	for _, tt := range tests {
+		if got := HumanReadableSize(tt.bytes); got != tt.want {
+			t.Errorf("HumanReadableSize(%d) = %v, want %v", tt.bytes, got, tt.want)
+		}
+	}
+}
+
+func TestNilStats(t *testing.T) {
+	var stats *Stats
+	stats.StageStarted(Scan)
+	stats.FileScanned("/photos/a.jpg", 100)
+	stats.Duplicate("/photos/a.jpg", 100)
+	stats.Moved("/photos/a.jpg", 100)
+	stats.Error(ErrorOpen)
+	stats.StageFinished(Scan)
+	if progress := stats.Progress(); progress != (Progress{}) {
+		t.Errorf("Progress() = %+v, want zero", progress)
+	}
+}
+
+func TestSummaryBreakdown(t *testing.T) {
+	stats := New([]string{"/photos", "/backup"})
+	stats.FileScanned("/photos/a.JPG", 100)
+	stats.FileScanned("/backup/a.jpg", 100)
+	stats.FileScanned("/backup/notes", 10)
+	stats.FileScanned("/elsewhere/b.txt", 5)
+	stats.DuplicateGroup()
+	stats.Duplicate("/backup/a.jpg", 100)
+	stats.Moved("/backup/a.jpg", 100)
+	stats.Error(ErrorOpen)
+
+	summary := stats.Summary()
+	if summary.FilesScanned != 4 || summary.BytesScanned != 215 {
+		t.Errorf("scanned %d files %d bytes, want 4 files 215 bytes", summary.FilesScanned, summary.BytesScanned)
+	}
+	if summary.DuplicateGroups != 1 || summary.DuplicateBytes != 100 || summary.BytesReclaimed != 100 {
+		t.Errorf("unexpected duplicate totals: %+v", summary)
+	}
+	if summary.Errors[ErrorOpen] != 1 {
+		t.Errorf("open errors = %d, want 1", summary.Errors[ErrorOpen])
+	}
+	wantRoots := []Breakdown{
+		{Name: "/photos", Files: 1, Bytes: 100},
+		{Name: "/backup", Files: 2, Bytes: 110, Duplicates: 1, DuplicateBytes: 100, Moved: 1, BytesReclaimed: 100},
+		{Name: OtherRoot, Files: 1, Bytes: 5},
+	}
+	if len(summary.ByRoot) != len(wantRoots) {
+		t.Fatalf("ByRoot = %+v, want %+v", summary.ByRoot, wantRoots)
+	}
+	for i := range wantRoots {
+		if summary.ByRoot[i] != wantRoots[i] {
+			t.Errorf("ByRoot[%d] = %+v, want %+v", i, summary.ByRoot[i], wantRoots[i])
+		}
+	}
+	if first := summary.ByExtension[0]; first.Name != ".jpg" || first.Files != 2 {
+		t.Errorf("ByExtension[0] = %+v, want .jpg with 2 files", first)
+	}
+}
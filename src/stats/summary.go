@@ -0,0 +1,215 @@
+package stats
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+)
+
+type Summary struct {
+	FilesScanned    int64            `json:"filesScanned"`
+	BytesScanned    int64            `json:"bytesScanned"`
+	Samples         []SampleStage    `json:"samples"`
+	HeadHashes      int64            `json:"headHashes"`
+	HeadHashedBytes int64            `json:"headHashedBytes"`
+	FullHashes      int64            `json:"fullHashes"`
+	FullHashedBytes int64            `json:"fullHashedBytes"`
+	CachedHashes    int64            `json:"cachedHashes"`
+	ThrottleSeconds float64          `json:"throttleSeconds"`
+	ComparedBytes   int64            `json:"comparedBytes"`
+	AttributeHits   int64            `json:"attributeHits"`
+	HeadHashHits    int64            `json:"headHashHits"`
+	FullHashHits    int64            `json:"fullHashHits"`
+	DuplicateGroups int64            `json:"duplicateGroups"`
+	Duplicates      int64            `json:"duplicates"`
+	DuplicateBytes  int64            `json:"duplicateBytes"`
+	FilesMoved      int64            `json:"filesMoved"`
+	BytesReclaimed  int64            `json:"bytesReclaimed"`
+	Errors          map[string]int64 `json:"errors"`
+	Stages          []Stage          `json:"stages"`
+	ElapsedSeconds  float64          `json:"elapsedSeconds"`
+	ByRoot          []Breakdown      `json:"byRoot"`
+	ByExtension     []Breakdown      `json:"byExtension"`
+}
+
+// SampleStage counts the files hashed by one stage of the sampling chain, and how many of them it ruled out
+type SampleStage struct {
+	Name       string `json:"name"`
+	Files      int64  `json:"files"`
+	Bytes      int64  `json:"bytes"`
+	Passed     int64  `json:"passed"`
+	Eliminated int64  `json:"eliminated"`
+}
+
+type Stage struct {
+	Name           string  `json:"name"`
+	ElapsedSeconds float64 `json:"elapsedSeconds"`
+}
+
+// Breakdown is the share of the totals for a single root directory or file extension
+type Breakdown struct {
+	Name           string `json:"name"`
+	Files          int64  `json:"files"`
+	Bytes          int64  `json:"bytes"`
+	Duplicates     int64  `json:"duplicates"`
+	DuplicateBytes int64  `json:"duplicateBytes"`
+	Moved          int64  `json:"moved"`
+	BytesReclaimed int64  `json:"bytesReclaimed"`
+}
+
+// Summary takes a snapshot, it can be called while the stages are still running
+func (stats *Stats) Summary() *Summary {
+	now := time.Now()
+	summary := &Summary{
+		FilesScanned:    atomic.LoadInt64(&stats.filesScanned),
+		BytesScanned:    atomic.LoadInt64(&stats.bytesScanned),
+		HeadHashes:      atomic.LoadInt64(&stats.headHashes),
+		HeadHashedBytes: atomic.LoadInt64(&stats.headHashedBytes),
+		FullHashes:      atomic.LoadInt64(&stats.fullHashes),
+		FullHashedBytes: atomic.LoadInt64(&stats.fullHashedBytes),
+		CachedHashes:    atomic.LoadInt64(&stats.cachedHashes),
+		ThrottleSeconds: time.Duration(atomic.LoadInt64(&stats.throttledNanos)).Seconds(),
+		ComparedBytes:   atomic.LoadInt64(&stats.comparedBytes),
+		AttributeHits:   atomic.LoadInt64(&stats.attributeHits),
+		HeadHashHits:    atomic.LoadInt64(&stats.headHashHits),
+		FullHashHits:    atomic.LoadInt64(&stats.fullHashHits),
+		DuplicateGroups: atomic.LoadInt64(&stats.duplicateGroups),
+		Duplicates:      atomic.LoadInt64(&stats.duplicates),
+		DuplicateBytes:  atomic.LoadInt64(&stats.duplicateBytes),
+		FilesMoved:      atomic.LoadInt64(&stats.filesMoved),
+		BytesReclaimed:  atomic.LoadInt64(&stats.bytesReclaimed),
+		Samples:         []SampleStage{},
+		Errors:          make(map[string]int64),
+		Stages:          []Stage{},
+		ElapsedSeconds:  now.Sub(stats.started).Seconds(),
+		ByRoot:          []Breakdown{},
+		ByExtension:     []Breakdown{},
+	}
+
+	stats.lock.Lock()
+	defer stats.lock.Unlock()
+	for kind, count := range stats.errors {
+		summary.Errors[kind] = count
+	}
+	for _, name := range stats.sampleOrder {
+		s := *stats.samples[name]
+		s.Eliminated = s.Files - s.Passed
+		summary.Samples = append(summary.Samples, s)
+	}
+	for _, name := range []string{Scan, Match, Move} {
+		if s, ok := stats.stages[name]; ok {
+			finished := s.finished
+			if finished.IsZero() {
+				finished = now
+			}
+			summary.Stages = append(summary.Stages, Stage{Name: name, ElapsedSeconds: finished.Sub(s.started).Seconds()})
+		}
+	}
+	// roots in priority order, then anything reached through symbolic links
+	for _, root := range stats.roots {
+		if b, ok := stats.byRoot[root]; ok {
+			summary.ByRoot = append(summary.ByRoot, *b)
+		}
+	}
+	if b, ok := stats.byRoot[OtherRoot]; ok {
+		summary.ByRoot = append(summary.ByRoot, *b)
+	}
+	for _, b := range stats.byExtension {
+		summary.ByExtension = append(summary.ByExtension, *b)
+	}
+	sort.Slice(summary.ByExtension, func(i, j int) bool {
+		a, b := summary.ByExtension[i], summary.ByExtension[j]
+		if a.DuplicateBytes != b.DuplicateBytes {
+			return a.DuplicateBytes > b.DuplicateBytes
+		}
+		return a.Name < b.Name
+	})
+	return summary
+}
+
+func (summary *Summary) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(summary)
+}
+
+func (summary *Summary) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "Summary:\n")
+	fmt.Fprintf(tw, "  files scanned:\t%d\t%s\n", summary.FilesScanned, HumanReadableSize(summary.BytesScanned))
+	for _, s := range summary.Samples {
+		fmt.Fprintf(tw, "  sample %s:\t%d\t%s\t%d eliminated\n", s.Name, s.Files, HumanReadableSize(s.Bytes), s.Eliminated)
+	}
+	fmt.Fprintf(tw, "  head hashes:\t%d\t%s\n", summary.HeadHashes, HumanReadableSize(summary.HeadHashedBytes))
+	fmt.Fprintf(tw, "  full hashes:\t%d\t%s\n", summary.FullHashes, HumanReadableSize(summary.FullHashedBytes))
+	if summary.CachedHashes > 0 {
+		fmt.Fprintf(tw, "  cached hashes:\t%d\t\n", summary.CachedHashes)
+	}
+	fmt.Fprintf(tw, "  duplicate groups:\t%d\t\n", summary.DuplicateGroups)
+	fmt.Fprintf(tw, "  duplicates:\t%d\t%s\n", summary.Duplicates, HumanReadableSize(summary.DuplicateBytes))
+	fmt.Fprintf(tw, "  moved to trash:\t%d\t%s\n", summary.FilesMoved, HumanReadableSize(summary.BytesReclaimed))
+	kinds := make([]string, 0, len(summary.Errors))
+	for kind := range summary.Errors {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	for _, kind := range kinds {
+		fmt.Fprintf(tw, "  %s errors:\t%d\t\n", kind, summary.Errors[kind])
+	}
+	for _, s := range summary.Stages {
+		fmt.Fprintf(tw, "  %s time:\t%v\t\n", s.Name, secondsToDuration(s.ElapsedSeconds))
+	}
+	if summary.ThrottleSeconds > 0 {
+		fmt.Fprintf(tw, "  throttled time:\t%v\t\n", secondsToDuration(summary.ThrottleSeconds))
+	}
+	fmt.Fprintf(tw, "  total time:\t%v\t\n", secondsToDuration(summary.ElapsedSeconds))
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if err := writeBreakdowns(w, "Root", summary.ByRoot); err != nil {
+		return err
+	}
+	return writeBreakdowns(w, "Extension", summary.ByExtension)
+}
+
+func writeBreakdowns(w io.Writer, title string, breakdowns []Breakdown) error {
+	if len(breakdowns) == 0 {
+		return nil
+	}
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "%s\tfiles\tsize\tduplicates\tduplicate size\tmoved\treclaimed\n", title)
+	for _, b := range breakdowns {
+		fmt.Fprintf(tw, "  %s\t%d\t%s\t%d\t%s\t%d\t%s\n",
+			b.Name, b.Files, HumanReadableSize(b.Bytes),
+			b.Duplicates, HumanReadableSize(b.DuplicateBytes),
+			b.Moved, HumanReadableSize(b.BytesReclaimed))
+	}
+	return tw.Flush()
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second)).Round(time.Millisecond)
+}
+
+var sizeSuffixes = []string{"K", "M", "G", "T", "P", "E"}
+
+// HumanReadableSize formats bytes with the same suffixes accepted by --min-size e.g. 1.5K, 4.2T
+func HumanReadableSize(bytes int64) string {
+	if bytes < 1024 && bytes > -1024 {
+		return fmt.Sprintf("%d", bytes)
+	}
+	scaled := float64(bytes)
+	suffix := ""
+	for _, next := range sizeSuffixes {
+		if scaled < 1024 && scaled > -1024 {
+			break
+		}
+		scaled /= 1024
+		suffix = next
+	}
+	return fmt.Sprintf("%.1f%s", scaled, suffix)
+}
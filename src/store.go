@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"github.com/glxxyz/dedupe/repo"
+	"github.com/glxxyz/dedupe/stats"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// The store is the trash laid out by the SHA-256 of each file's contents, identical files trashed from different
+// places share a single copy, and the journal is the index of where each one came from.
+
+// storePath is ab/cd/<sha256> under the trash, so no one directory gets too big
+func storePath(trash string, digest string) string {
+	return filepath.Join(trash, digest[:2], digest[2:4], digest)
+}
+
+// moveToStore moves a duplicate into the store, or removes it if the store already has its contents
+func moveToStore(options MoveOptions, reader repo.ReadOptions, statistics *stats.Stats, keep string, filePath string) {
+	info, err := os.Lstat(filePath)
+	if err != nil {
+		errLog.Printf("error moving file: %q: %v\n", filePath, err)
+		statistics.Error(stats.ErrorMove)
+		return
+	}
+	digest, err := repo.Digest(reader, statistics, filePath)
+	if err != nil {
+		return
+	}
+	destPath := storePath(options.Trash(), digest)
+	trashLock.Lock()
+	defer trashLock.Unlock()
+	_, statErr := os.Lstat(destPath)
+	stored := statErr == nil
+	if stored {
+		// the digest says they're the same, but the file could have changed since it was hashed
+		if same, err := sameContents(filePath, destPath); err != nil || !same {
+			errLog.Printf("not moving: %q as it's changed since it was hashed\n", filePath)
+			statistics.Error(stats.ErrorCollision)
+			return
+		}
+	}
+	fmt.Printf(
+		"Move:\t%v\t%v\n",
+		strings.Replace(filePath, " ", "\\ ", -1),
+		strings.Replace(destPath, " ", "\\ ", -1))
+	folderPath := filepath.Dir(destPath)
+	if stored {
+		if err := os.Remove(filePath); err != nil {
+			errLog.Printf("error removing file: %q: %v\n", filePath, err)
+			statistics.Error(stats.ErrorMove)
+			return
+		}
+	} else if err := os.MkdirAll(folderPath, os.ModePerm); err != nil {
+		errLog.Printf("error creating directory: %q: %v\n", folderPath, err)
+		statistics.Error(stats.ErrorMkdir)
+		return
+	} else if err := os.Rename(filePath, destPath); err != nil {
+		errLog.Printf("error moving file from: %q to: %q: %v\n", filePath, destPath, err)
+		statistics.Error(stats.ErrorMove)
+		return
+	}
+	statistics.Moved(filePath, info.Size())
+	entry := journalEntry{
+		Run:      runStarted,
+		Time:     time.Now(),
+		Original: filePath,
+		Trashed:  destPath,
+		Layout:   options.TrashLayout(),
+		Digest:   digest,
+		Keep:     keep,
+		Size:     info.Size(),
+	}
+	if err := appendJournal(options.Trash(), entry); err != nil {
+		errLog.Printf("error writing trash journal: %v\n", err)
+		statistics.Error(stats.ErrorJournal)
+	}
+}
+
+// copyFile copies a file along with its permissions and modification time, it won't replace one that's there
+func copyFile(src string, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chtimes(dst, info.ModTime(), info.ModTime())
+	}
+	if err != nil {
+		os.Remove(dst)
+	}
+	return err
+}
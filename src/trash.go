@@ -0,0 +1,294 @@
+package main
+
+import (
+	"fmt"
+	"github.com/glxxyz/dedupe/repo"
+	"github.com/glxxyz/dedupe/stats"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+type TrashOptions interface {
+	Trash() string
+	Paths() []string
+	Verbose() bool
+}
+
+// restoreTrash moves files back from the trash to where they came from, unless something else is there now
+func restoreTrash(options TrashOptions) error {
+	entries, err := readJournal(options.Trash())
+	if err != nil {
+		return fmt.Errorf("failed to read trash journal: %w", err)
+	}
+	refs := trashRefs(entries)
+	var kept []journalEntry
+	var restored, failed int
+	for _, entry := range entries {
+		if !restoring(options, entry.Original) {
+			kept = append(kept, entry)
+			continue
+		}
+		if _, err := os.Lstat(entry.Trashed); os.IsNotExist(err) {
+			errLog.Printf("file is no longer in the trash: %q\n", entry.Trashed)
+			continue
+		}
+		if _, err := os.Lstat(entry.Original); err == nil {
+			errLog.Printf("not restoring: %q as there's already a file at: %q\n", entry.Trashed, entry.Original)
+			kept = append(kept, entry)
+			failed++
+			continue
+		}
+		fmt.Printf("Restore:\t%v\t%v\n", entry.Trashed, entry.Original)
+		if err := os.MkdirAll(filepath.Dir(entry.Original), os.ModePerm); err != nil {
+			errLog.Printf("error creating directory: %q: %v\n", filepath.Dir(entry.Original), err)
+		} else if err := takeFromTrash(entry, refs); err != nil {
+			errLog.Printf("error moving file from: %q to: %q: %v\n", entry.Trashed, entry.Original, err)
+		} else {
+			removeTrashInfo(entry)
+			removeEmptyParents(options.Trash(), entry.Trashed)
+			restored++
+			continue
+		}
+		kept = append(kept, entry)
+		failed++
+	}
+	if err := writeJournal(options.Trash(), kept); err != nil {
+		return fmt.Errorf("failed to write trash journal: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "restored %d files, %d left in the trash\n", restored, len(kept))
+	if failed > 0 {
+		return fmt.Errorf("failed to restore %d files", failed)
+	}
+	return nil
+}
+
+// trashRefs counts the entries for each file in the trash, which is more than one for those shared in the store
+func trashRefs(entries []journalEntry) map[string]int {
+	refs := make(map[string]int)
+	for _, entry := range entries {
+		refs[entry.Trashed]++
+	}
+	return refs
+}
+
+// takeFromTrash moves a file out of the trash, or copies it if other entries still share it
+func takeFromTrash(entry journalEntry, refs map[string]int) error {
+	var err error
+	if refs[entry.Trashed] > 1 {
+		err = copyFile(entry.Trashed, entry.Original)
+	} else {
+		err = os.Rename(entry.Trashed, entry.Original)
+	}
+	if err == nil {
+		refs[entry.Trashed]--
+	}
+	return err
+}
+
+// extractTrash copies files back to where they came from, leaving the trash and its journal as they are
+func extractTrash(options TrashOptions) error {
+	entries, err := readJournal(options.Trash())
+	if err != nil {
+		return fmt.Errorf("failed to read trash journal: %w", err)
+	}
+	var extracted, failed int
+	for _, entry := range entries {
+		if !restoring(options, entry.Original) {
+			continue
+		}
+		if _, err := os.Lstat(entry.Original); err == nil {
+			errLog.Printf("not extracting: %q as there's already a file at: %q\n", entry.Trashed, entry.Original)
+			failed++
+			continue
+		}
+		fmt.Printf("Extract:\t%v\t%v\n", entry.Trashed, entry.Original)
+		if err := os.MkdirAll(filepath.Dir(entry.Original), os.ModePerm); err != nil {
+			errLog.Printf("error creating directory: %q: %v\n", filepath.Dir(entry.Original), err)
+			failed++
+		} else if err := copyFile(entry.Trashed, entry.Original); err != nil {
+			errLog.Printf("error copying file from: %q to: %q: %v\n", entry.Trashed, entry.Original, err)
+			failed++
+		} else {
+			extracted++
+		}
+	}
+	fmt.Fprintf(os.Stderr, "extracted %d files from the trash\n", extracted)
+	if failed > 0 {
+		return fmt.Errorf("failed to extract %d files", failed)
+	}
+	return nil
+}
+
+// restoring is true if the file came from one of the paths being restored, or there aren't any
+func restoring(options TrashOptions, original string) bool {
+	if len(options.Paths()) == 0 {
+		return true
+	}
+	for _, path := range options.Paths() {
+		if contains(path, original) {
+			return true
+		}
+	}
+	return false
+}
+
+// removeTrashInfo removes what the desktop trash knows about a file that's no longer there
+func removeTrashInfo(entry journalEntry) {
+	if entry.Info == "" {
+		return
+	}
+	if err := os.Remove(entry.Info); err != nil && !os.IsNotExist(err) {
+		errLog.Printf("error removing trash info: %q: %v\n", entry.Info, err)
+	}
+}
+
+type TrashVerifyOptions interface {
+	TrashOptions
+	ReadOptions
+}
+
+type PurgeOptions interface {
+	TrashVerifyOptions
+	OlderThan() time.Duration
+}
+
+// verifyTrash checks every file in the trash still has an identical file that was kept instead
+func verifyTrash(options TrashVerifyOptions) error {
+	entries, err := readJournal(options.Trash())
+	if err != nil {
+		return fmt.Errorf("failed to read trash journal: %w", err)
+	}
+	useBackground(options.Background(), options.Verbose())
+	reader := newFileReader(options)
+	statistics := stats.New(nil)
+	unverified := 0
+	for _, entry := range entries {
+		if !verifyEntry(options, reader, statistics, entry) {
+			unverified++
+		}
+	}
+	if unverified > 0 {
+		return fmt.Errorf("%d of %d files in the trash don't have an identical file kept", unverified, len(entries))
+	}
+	fmt.Fprintf(os.Stderr, "all %d files in the trash verified\n", len(entries))
+	return nil
+}
+
+// verifyEntry hashes the trashed file and the file kept instead, printing why if they're not identical
+func verifyEntry(options TrashOptions, reader repo.ReadOptions, statistics *stats.Stats, entry journalEntry) bool {
+	reason := ""
+	if trashed, err := os.Lstat(entry.Trashed); err != nil {
+		reason = "no longer in the trash"
+	} else if keep, err := os.Stat(entry.Keep); err != nil {
+		reason = "kept file is gone"
+	} else if keep.Size() != trashed.Size() {
+		reason = "kept file changed"
+	} else if trashedHash, err := repo.Digest(reader, statistics, entry.Trashed); err != nil {
+		reason = "couldn't be read"
+	} else if keepHash, err := repo.Digest(reader, statistics, entry.Keep); err != nil {
+		reason = "kept file couldn't be read"
+	} else if keepHash != trashedHash {
+		reason = "kept file changed"
+	}
+	if reason != "" {
+		fmt.Printf("Unverified:\t%v\t%v\n", entry.Trashed, reason)
+		return false
+	}
+	if options.Verbose() {
+		fmt.Printf("Verified:\t%v\n", entry.Trashed)
+	}
+	return true
+}
+
+// purgeTrash permanently deletes the files that have been in the trash long enough, as long as they verify
+func purgeTrash(options PurgeOptions) error {
+	entries, err := readJournal(options.Trash())
+	if err != nil {
+		return fmt.Errorf("failed to read trash journal: %w", err)
+	}
+	cutoff := time.Now().Add(-options.OlderThan())
+	useBackground(options.Background(), options.Verbose())
+	reader := newFileReader(options)
+	statistics := stats.New(nil)
+	refs := trashRefs(entries)
+	var kept []journalEntry
+	var runs []*purgedRun
+	byRun := make(map[time.Time]*purgedRun)
+	failed := 0
+	for _, entry := range entries {
+		if entry.Time.After(cutoff) {
+			kept = append(kept, entry)
+			continue
+		}
+		if _, err := os.Lstat(entry.Trashed); os.IsNotExist(err) {
+			// already deleted some other way, so there's nothing to do but forget it
+			continue
+		}
+		if !verifyEntry(options, reader, statistics, entry) {
+			kept = append(kept, entry)
+			continue
+		}
+		if options.Verbose() {
+			fmt.Printf("Purge:\t%v\n", entry.Trashed)
+		}
+		// the store only deletes a file along with the last of the entries sharing it
+		shared := refs[entry.Trashed] > 1
+		if !shared {
+			if err := os.Remove(entry.Trashed); err != nil {
+				errLog.Printf("error deleting file: %q: %v\n", entry.Trashed, err)
+				kept = append(kept, entry)
+				failed++
+				continue
+			}
+		}
+		refs[entry.Trashed]--
+		removeTrashInfo(entry)
+		removeEmptyParents(options.Trash(), entry.Trashed)
+		run, ok := byRun[entry.Run]
+		if !ok {
+			run = &purgedRun{started: entry.Run}
+			byRun[entry.Run] = run
+			runs = append(runs, run)
+		}
+		run.files++
+		if !shared {
+			run.bytes += entry.Size
+		}
+	}
+	if err := writeJournal(options.Trash(), kept); err != nil {
+		return fmt.Errorf("failed to write trash journal: %w", err)
+	}
+	writePurged(os.Stderr, runs, len(kept))
+	if failed > 0 {
+		return fmt.Errorf("failed to purge %d files", failed)
+	}
+	return nil
+}
+
+// purgedRun is what was deleted of the files moved to the trash by a single run
+type purgedRun struct {
+	started time.Time
+	files   int64
+	bytes   int64
+}
+
+func writePurged(w io.Writer, runs []*purgedRun, left int) {
+	sort.Slice(runs, func(i, j int) bool { return runs[i].started.Before(runs[j].started) })
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	var files, bytes int64
+	if len(runs) > 0 {
+		fmt.Fprintf(tw, "Run\tfiles\treclaimed\n")
+	}
+	for _, run := range runs {
+		fmt.Fprintf(tw, "  %s\t%d\t%s\n", run.started.Local().Format("2006-01-02 15:04:05"), run.files,
+			stats.HumanReadableSize(run.bytes))
+		files += run.files
+		bytes += run.bytes
+	}
+	tw.Flush()
+	fmt.Fprintf(w, "purged %d files %s from the trash, %d left\n", files, stats.HumanReadableSize(bytes), left)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"github.com/glxxyz/dedupe/dedupe"
+	"github.com/glxxyz/dedupe/param"
+	"github.com/glxxyz/dedupe/repo"
+	"github.com/glxxyz/dedupe/stats"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// uniquesAction sees every file as it's walked, and every group of duplicates, to find the files that have no
+// duplicate in a higher priority root
+type uniquesAction struct {
+	paths    []string
+	minBytes int64
+	lock     sync.Mutex
+	files    map[string]int64 // path -> size, of the files in lower priority roots
+	matched  map[string]bool
+}
+
+func newUniquesAction(paths []string, minBytes int64) *uniquesAction {
+	return &uniquesAction{paths: paths, minBytes: minBytes, files: make(map[string]int64), matched: make(map[string]bool)}
+}
+
+// Include remembers the files that are matched, it doesn't filter any out
+func (action *uniquesAction) Include(path string, info os.FileInfo) bool {
+	if info.Mode().IsRegular() && info.Size() >= action.minBytes && repo.RootOf(action.paths, path) > 0 {
+		action.lock.Lock()
+		action.files[path] = info.Size()
+		action.lock.Unlock()
+	}
+	return true
+}
+
+// Apply marks the duplicates that are in a lower priority root than the file kept, the group is in priority order
+func (action *uniquesAction) Apply(group dedupe.Group) {
+	keepRoot := repo.RootOf(action.paths, group.Keep().Path())
+	action.lock.Lock()
+	defer action.lock.Unlock()
+	for _, file := range group.Duplicates() {
+		if repo.RootOf(action.paths, file.Path()) > keepRoot {
+			action.matched[file.Path()] = true
+		}
+	}
+}
+
+// uniques returns the files that weren't matched, sorted so they're grouped by directory
+func (action *uniquesAction) uniques() []string {
+	var uniques []string
+	for path := range action.files {
+		if !action.matched[path] {
+			uniques = append(uniques, path)
+		}
+	}
+	sort.Slice(uniques, func(i, j int) bool {
+		if dirI, dirJ := filepath.Dir(uniques[i]), filepath.Dir(uniques[j]); dirI != dirJ {
+			return dirI < dirJ
+		}
+		return uniques[i] < uniques[j]
+	})
+	return uniques
+}
+
+// findUniques lists the files in lower priority roots that don't have a duplicate in a higher priority one
+func findUniques(options *param.Options) error {
+	statistics := stats.New(options.Paths())
+	action := newUniquesAction(options.Paths(), options.MinBytes())
+	if err := runScan(options, scanOptions(options, statistics, action)); err != nil {
+		return err
+	}
+	uniques := action.uniques()
+	var bytes int64
+	for _, path := range uniques {
+		bytes += action.files[path]
+	}
+	dirs := writeUniques(os.Stdout, uniques)
+	fmt.Fprintf(os.Stderr, "%d unique files %s in %d directories\n", len(uniques), stats.HumanReadableSize(bytes), dirs)
+	if options.UniquesTo() == "" {
+		return nil
+	}
+	verb, done := "copying", "copied"
+	if options.UniquesMove() {
+		verb, done = "moving", "moved"
+	}
+	failed := 0
+	for _, path := range uniques {
+		if err := copyUnique(options, path); err != nil {
+			errLog.Printf("error %s file: %q to: %q: %v\n", verb, path, options.UniquesTo(), err)
+			failed++
+		}
+	}
+	fmt.Fprintf(os.Stderr, "%s %d files to %s\n", done, len(uniques)-failed, options.UniquesTo())
+	if failed > 0 {
+		return fmt.Errorf("failed to copy or move %d files", failed)
+	}
+	return nil
+}
+
+// writeUniques lists the files under a line for each directory, like ls -R, and returns how many directories there are
+func writeUniques(w io.Writer, uniques []string) int {
+	dirs := 0
+	for i, path := range uniques {
+		dir := filepath.Dir(path)
+		if i == 0 || dir != filepath.Dir(uniques[i-1]) {
+			if i > 0 {
+				fmt.Fprintln(w)
+			}
+			fmt.Fprintf(w, "%s:\n", dir)
+			dirs++
+		}
+		fmt.Fprintf(w, "\t%s\n", filepath.Base(path))
+	}
+	return dirs
+}
+
+// copyUnique copies or moves a file to the same absolute path under --copy-to or --move-to, leaving anything there
+func copyUnique(options *param.Options, path string) error {
+	destPath := filepath.Join(options.UniquesTo(), path)
+	if err := os.MkdirAll(filepath.Dir(destPath), os.ModePerm); err != nil {
+		return err
+	}
+	if !options.UniquesMove() {
+		return copyFile(path, destPath)
+	} else if _, err := os.Lstat(destPath); err == nil {
+		return fmt.Errorf("there's already a file at: %q", destPath)
+	}
+	return os.Rename(path, destPath)
+}
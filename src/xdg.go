@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"github.com/glxxyz/dedupe/param"
+	"github.com/glxxyz/dedupe/stats"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The desktop trash follows https://specifications.freedesktop.org/trash-spec/trashspec-latest.html, files on the
+// same device as the home trash go there, and others go to a trash at the top of their own volume.
+
+// homeTrash is $XDG_DATA_HOME/Trash, which defaults to ~/.local/share/Trash
+func homeTrash() (string, error) {
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dataHome = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(dataHome, "Trash"), nil
+}
+
+// xdgTrashFor returns the trash for a file, along with the top of its volume if it's not the home trash, as the
+// original paths in that trash are relative to it
+func xdgTrashFor(filePath string) (string, string, error) {
+	home, err := homeTrash()
+	if err != nil {
+		return "", "", err
+	}
+	if err := os.MkdirAll(home, 0700); err != nil {
+		return "", "", err
+	}
+	homeDevice, err := deviceOf(home)
+	if err != nil {
+		return "", "", err
+	}
+	device, err := deviceOf(filepath.Dir(filePath))
+	if err != nil {
+		return "", "", err
+	}
+	if device == homeDevice {
+		return home, "", nil
+	}
+	topdir := filepath.Dir(filePath)
+	for parent := filepath.Dir(topdir); parent != topdir; parent = filepath.Dir(topdir) {
+		if parentDevice, err := deviceOf(parent); err != nil || parentDevice != device {
+			break
+		}
+		topdir = parent
+	}
+	uid := strconv.Itoa(os.Getuid())
+	// an administrator can set up a shared .Trash, it has to have the sticky bit and not be a symbolic link
+	if shared, err := os.Lstat(filepath.Join(topdir, ".Trash")); err == nil && shared.IsDir() && shared.Mode()&os.ModeSticky != 0 {
+		trash := filepath.Join(topdir, ".Trash", uid)
+		if err := os.MkdirAll(trash, 0700); err == nil {
+			return trash, topdir, nil
+		}
+	}
+	return filepath.Join(topdir, ".Trash-"+uid), topdir, nil
+}
+
+// moveToXDGTrash moves a duplicate to the desktop trash, claiming a unique name by creating its .trashinfo first
+func moveToXDGTrash(statistics *stats.Stats, keep string, filePath string) {
+	info, err := os.Lstat(filePath)
+	if err != nil {
+		errLog.Printf("error moving file: %q: %v\n", filePath, err)
+		statistics.Error(stats.ErrorMove)
+		return
+	}
+	trash, topdir, err := xdgTrashFor(filePath)
+	if err == nil {
+		err = os.MkdirAll(filepath.Join(trash, "files"), 0700)
+	}
+	if err == nil {
+		err = os.MkdirAll(filepath.Join(trash, "info"), 0700)
+	}
+	if err != nil {
+		errLog.Printf("error creating trash for: %q: %v\n", filePath, err)
+		statistics.Error(stats.ErrorMkdir)
+		return
+	}
+	original := filePath
+	if topdir != "" {
+		if original, err = filepath.Rel(topdir, filePath); err != nil {
+			original = filePath
+		}
+	}
+	now := time.Now()
+	trashInfo := fmt.Sprintf("[Trash Info]\nPath=%s\nDeletionDate=%s\n",
+		(&url.URL{Path: filepath.ToSlash(original)}).EscapedPath(), now.Format("2006-01-02T15:04:05"))
+
+	base := filepath.Base(filePath)
+	for attempt := 1; ; attempt++ {
+		name := base
+		if attempt > 1 {
+			name = numberedName(base, attempt)
+		}
+		infoPath := filepath.Join(trash, "info", name+".trashinfo")
+		destPath := filepath.Join(trash, "files", name)
+		claimed, err := claimTrashName(infoPath, destPath, trashInfo)
+		if err != nil {
+			errLog.Printf("error writing trash info: %q: %v\n", infoPath, err)
+			statistics.Error(stats.ErrorMove)
+			return
+		} else if !claimed {
+			continue
+		}
+		fmt.Printf(
+			"Move:\t%v\t%v\n",
+			strings.Replace(filePath, " ", "\\ ", -1),
+			strings.Replace(destPath, " ", "\\ ", -1))
+		if err := os.Rename(filePath, destPath); err != nil {
+			os.Remove(infoPath)
+			errLog.Printf("error moving file from: %q to: %q: %v\n", filePath, destPath, err)
+			statistics.Error(stats.ErrorMove)
+			return
+		}
+		statistics.Moved(filePath, info.Size())
+		entry := journalEntry{
+			Run:      runStarted,
+			Time:     now,
+			Original: filePath,
+			Trashed:  destPath,
+			Info:     infoPath,
+			Keep:     keep,
+			Size:     info.Size(),
+		}
+		if err := appendJournal(param.TrashXDG, entry); err != nil {
+			errLog.Printf("error writing trash journal: %v\n", err)
+			statistics.Error(stats.ErrorJournal)
+		}
+		return
+	}
+}
+
+// claimTrashName returns false if the name is already taken by another file in the trash
+func claimTrashName(infoPath string, destPath string, trashInfo string) (bool, error) {
+	file, err := os.OpenFile(infoPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if os.IsExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	_, err = file.WriteString(trashInfo)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(infoPath)
+		return false, err
+	}
+	// a file without its .trashinfo can be left behind by something else that crashed
+	if _, err := os.Lstat(destPath); err == nil {
+		os.Remove(infoPath)
+		return false, nil
+	}
+	return true, nil
+}